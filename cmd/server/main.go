@@ -7,14 +7,19 @@ import (
 	"net/http"
 
 	apiserver "bytetrade.io/web3os/system-server/pkg/apiserver/v1alpha1"
+	"bytetrade.io/web3os/system-server/pkg/constants"
+	"bytetrade.io/web3os/system-server/pkg/features"
 	sysclientset "bytetrade.io/web3os/system-server/pkg/generated/clientset/versioned"
 	informers "bytetrade.io/web3os/system-server/pkg/generated/informers/externalversions"
 	"bytetrade.io/web3os/system-server/pkg/generated/listers/sys/v1alpha1"
+	"bytetrade.io/web3os/system-server/pkg/pki"
 	prodiverregistry "bytetrade.io/web3os/system-server/pkg/providerregistry/v1alpha1"
 	"bytetrade.io/web3os/system-server/pkg/signals"
+	"bytetrade.io/web3os/system-server/pkg/tracing"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/klog/v2"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -23,6 +28,14 @@ import (
 func main() {
 	klog.InitFlags(nil)
 	pflag.CommandLine.AddGoFlagSet(flag.CommandLine)
+	features.DefaultMutableFeatureGate.AddFlag(pflag.CommandLine)
+	if err := features.SetFromEnv(); err != nil {
+		klog.Fatal(err)
+	}
+	if err := constants.SetFromEnv(); err != nil {
+		klog.Fatal(err)
+	}
+	// exits on an invalid --feature-gates as well
 	pflag.Parse()
 
 	config := ctrl.GetConfigOrDie()
@@ -46,6 +59,22 @@ func main() {
 		Short: "system server",
 		Long:  `The system server provides underlayer IPC and event messages flow`,
 		Run: func(cmd *cobra.Command, args []string) {
+			if features.Enabled(features.ProviderMTLS) {
+				// before the controller issuing the certificates of providers
+				if err := pki.Init(apiCtx, kubernetes.NewForConfigOrDie(config), constants.MyNamespace); err != nil {
+					panic(err)
+				}
+			}
+
+			if features.Enabled(features.Tracing) {
+				shutdown, err := tracing.Init(apiCtx)
+				if err != nil {
+					panic(err)
+				}
+				// flush the spans of the last requests
+				defer shutdown(context.Background())
+			}
+
 			go func() {
 				defer cancel()
 				if err := APIRun(apiCtx, config, sysClient,
@@ -5,7 +5,9 @@ import (
 	"strings"
 
 	"bytetrade.io/web3os/system-server/pkg/utils"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 const (
@@ -71,12 +73,111 @@ type ProviderRegistryStatus struct {
 type OpApisItem struct {
 	Name string `json:"name,omitempty"`
 	URI  string `json:"uri,omitempty"`
+	// CacheTTL enables caching the responses of Get and List ops, the cached
+	// responses are invalidated by the mutations of the data type.
+	CacheTTL metav1.Duration `json:"cacheTTL,omitempty"`
+	// RequestSchema is the JSON Schema of the data of Create, Update and the
+	// custom actions, the invalid requests are rejected before the provider.
+	RequestSchema *runtime.RawExtension `json:"requestSchema,omitempty"`
+	// ResponseSchema is the JSON Schema of the provider responses, the invalid
+	// responses are never returned to the apps.
+	ResponseSchema *runtime.RawExtension `json:"responseSchema,omitempty"`
+	// Transform rewrites the requests to and the responses from the provider, so
+	// that a third-party service is fronted without an adapter.
+	Transform *Transform `json:"transform,omitempty"`
+}
+
+// Transform is the declarative transformation of an op.
+type Transform struct {
+	Request  *RequestTransform `json:"request,omitempty"`
+	Response *BodyTransform    `json:"response,omitempty"`
+}
+
+// RequestTransform rewrites the request sent to the provider.
+type RequestTransform struct {
+	// Method is the http method, POST if empty. The body is not sent with GET.
+	Method string `json:"method,omitempty"`
+	// Path replaces the uri of the op, with the placeholders {datatype}, {group},
+	// {version}, {op} and {dataid}, e.g. /v3/calendars/{dataid}
+	Path string `json:"path,omitempty"`
+	// SetHeaders are injected into the request, replacing the same headers.
+	SetHeaders map[string]string `json:"setHeaders,omitempty"`
+	// RemoveHeaders are removed from the request, e.g. Authorization.
+	RemoveHeaders []string `json:"removeHeaders,omitempty"`
+
+	BodyTransform `json:",inline"`
+}
+
+// BodyTransform rewrites a json body, in the order of unwrap, rename and wrap.
+type BodyTransform struct {
+	// Unwrap replaces the body with the field at the dotted path, e.g. data
+	// sends the data of the request envelope only.
+	Unwrap string `json:"unwrap,omitempty"`
+	// Rename renames the fields in the order of the rules, so a rule sees the
+	// fields renamed by the previous ones.
+	Rename []RenameRule `json:"rename,omitempty"`
+	// Wrap puts the body under the field, e.g. items for the list responses
+	// being arrays.
+	Wrap string `json:"wrap,omitempty"`
+}
+
+// RenameRule renames a field of a json body.
+type RenameRule struct {
+	// From is the dotted path of the field, * matches every element of an array
+	// or object, e.g. items.*.summary
+	From string `json:"from"`
+	// To is the new name of the last field of From, e.g. title
+	To string `json:"to"`
+}
+
+// The operators of FilterRule.
+const (
+	FilterIn           = "In"
+	FilterNotIn        = "NotIn"
+	FilterExists       = "Exists"
+	FilterDoesNotExist = "DoesNotExist"
+	FilterPrefix       = "Prefix"
+	FilterRegex        = "Regex"
+	FilterGt           = "Gt"
+	FilterLt           = "Lt"
+	// FilterRange matches a number in [values[0], values[1]], either bound can be empty.
+	FilterRange = "Range"
+)
+
+// the formats of the events delivered to a callback
+const (
+	// FormatLegacy is the dispatch request as is, the default.
+	FormatLegacy = "legacy"
+	// FormatCloudEvents is a CloudEvents 1.0 event in structured content mode.
+	FormatCloudEvents = "cloudevents"
+	// FormatCloudEventsBinary is a CloudEvents 1.0 event in binary content mode,
+	// the attributes are sent as ce-* headers and the data as body.
+	FormatCloudEventsBinary = "cloudevents-binary"
+)
+
+// FilterRule matches a field of the data dispatched to a watcher.
+type FilterRule struct {
+	// Path is the dotted json path of the field in the data, e.g. metadata.owner
+	Path     string   `json:"path"`
+	Operator string   `json:"operator"`
+	Values   []string `json:"values,omitempty"`
 }
 
 type Callback struct {
-	Op      string              `json:"op,omitempty"`
-	URI     string              `json:"uri,omitempty"`
+	Op  string `json:"op,omitempty"`
+	URI string `json:"uri,omitempty"`
+	// Filters matches the fields (dotted json paths) of data against exact values,
+	// the missing fields are ignored.
 	Filters map[string][]string `json:"filters,omitempty"`
+	// Rules are all required to match, the missing fields never match
+	// except with the DoesNotExist operator, NotIn included.
+	Rules []FilterRule `json:"rules,omitempty"`
+	// Expression is a CEL expression returns bool, evaluated on the whole
+	// dispatch request as `event`, e.g. event.data.priority > 3, the expressions
+	// running out of the cost limit never match.
+	Expression string `json:"expression,omitempty"`
+	// Format is the format of the delivered events, FormatLegacy if empty.
+	Format string `json:"format,omitempty"`
 }
 
 type With2FA struct {
@@ -100,6 +201,17 @@ type ProviderRegistrySpec struct {
 	Deployment  string       `json:"deployment"`
 	Namespace   string       `json:"namespace"`
 	Endpoint    string       `json:"endpoint"`
+	// SecretRef is the key of a Secret in Namespace used to sign the callbacks of
+	// a watcher with HMAC-SHA256, the callbacks are signed with the key of
+	// system-server if it's empty.
+	SecretRef *corev1.SecretKeySelector `json:"secretRef,omitempty"`
+	// SchemaConfigMap is the ConfigMap in Namespace holding the JSON Schemas of
+	// ops with keys "<op>.request.json" and "<op>.response.json", the inline
+	// schemas of OpApis take precedence.
+	SchemaConfigMap string `json:"schemaConfigMap,omitempty"`
+	// MaxRequestBodySize is the max bytes of the request bodies proxied to the
+	// legacy api of provider, the default of system-server if it's 0.
+	MaxRequestBodySize int64 `json:"maxRequestBodySize,omitempty"`
 }
 
 // +genclient
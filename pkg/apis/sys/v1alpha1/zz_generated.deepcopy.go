@@ -6,6 +6,7 @@
 package v1alpha1
 
 import (
+	v1 "k8s.io/api/core/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -135,6 +136,13 @@ func (in *Callback) DeepCopyInto(out *Callback) {
 			(*out)[key] = outVal
 		}
 	}
+	if in.Rules != nil {
+		in, out := &in.Rules, &out.Rules
+		*out = make([]FilterRule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
@@ -148,9 +156,46 @@ func (in *Callback) DeepCopy() *Callback {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FilterRule) DeepCopyInto(out *FilterRule) {
+	*out = *in
+	if in.Values != nil {
+		in, out := &in.Values, &out.Values
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FilterRule.
+func (in *FilterRule) DeepCopy() *FilterRule {
+	if in == nil {
+		return nil
+	}
+	out := new(FilterRule)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *OpApisItem) DeepCopyInto(out *OpApisItem) {
 	*out = *in
+	out.CacheTTL = in.CacheTTL
+	if in.RequestSchema != nil {
+		in, out := &in.RequestSchema, &out.RequestSchema
+		*out = new(runtime.RawExtension)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ResponseSchema != nil {
+		in, out := &in.ResponseSchema, &out.ResponseSchema
+		*out = new(runtime.RawExtension)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Transform != nil {
+		in, out := &in.Transform, &out.Transform
+		*out = new(Transform)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -274,7 +319,9 @@ func (in *ProviderRegistrySpec) DeepCopyInto(out *ProviderRegistrySpec) {
 	if in.OpApis != nil {
 		in, out := &in.OpApis, &out.OpApis
 		*out = make([]OpApisItem, len(*in))
-		copy(*out, *in)
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
 	if in.Callbacks != nil {
 		in, out := &in.Callbacks, &out.Callbacks
@@ -284,6 +331,11 @@ func (in *ProviderRegistrySpec) DeepCopyInto(out *ProviderRegistrySpec) {
 		}
 	}
 	in.Permission.DeepCopyInto(&out.Permission)
+	if in.SecretRef != nil {
+		in, out := &in.SecretRef, &out.SecretRef
+		*out = new(v1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -359,3 +411,95 @@ func (in *With2FA) DeepCopy() *With2FA {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BodyTransform) DeepCopyInto(out *BodyTransform) {
+	*out = *in
+	if in.Rename != nil {
+		in, out := &in.Rename, &out.Rename
+		*out = make([]RenameRule, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BodyTransform.
+func (in *BodyTransform) DeepCopy() *BodyTransform {
+	if in == nil {
+		return nil
+	}
+	out := new(BodyTransform)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RenameRule) DeepCopyInto(out *RenameRule) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RenameRule.
+func (in *RenameRule) DeepCopy() *RenameRule {
+	if in == nil {
+		return nil
+	}
+	out := new(RenameRule)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RequestTransform) DeepCopyInto(out *RequestTransform) {
+	*out = *in
+	if in.SetHeaders != nil {
+		in, out := &in.SetHeaders, &out.SetHeaders
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.RemoveHeaders != nil {
+		in, out := &in.RemoveHeaders, &out.RemoveHeaders
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	in.BodyTransform.DeepCopyInto(&out.BodyTransform)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RequestTransform.
+func (in *RequestTransform) DeepCopy() *RequestTransform {
+	if in == nil {
+		return nil
+	}
+	out := new(RequestTransform)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Transform) DeepCopyInto(out *Transform) {
+	*out = *in
+	if in.Request != nil {
+		in, out := &in.Request, &out.Request
+		*out = new(RequestTransform)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Response != nil {
+		in, out := &in.Response, &out.Response
+		*out = new(BodyTransform)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Transform.
+func (in *Transform) DeepCopy() *Transform {
+	if in == nil {
+		return nil
+	}
+	out := new(Transform)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -1,8 +1,162 @@
 package api
 
-import "errors"
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"syscall"
+
+	"github.com/emicklei/go-restful/v3"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
 
 var (
 	// ErrResourceNotFound indicates that a resource is not found.
 	ErrResourceNotFound = errors.New("resource not found")
 )
+
+// Reason is the stable, machine-readable reason of an error.
+type Reason string
+
+const (
+	ReasonBadRequest          Reason = "bad_request"
+	ReasonUnauthorized        Reason = "unauthorized"
+	ReasonForbidden           Reason = "forbidden"
+	ReasonNotFound            Reason = "not_found"
+	ReasonConflict            Reason = "conflict"
+	ReasonTooLarge            Reason = "too_large"
+	ReasonTooManyRequests     Reason = "too_many_requests"
+	ReasonValidationFailed    Reason = "validation_failed"
+	ReasonProviderUnavailable Reason = "provider_unavailable"
+	ReasonTimeout             Reason = "timeout"
+	ReasonInternal            Reason = "internal"
+)
+
+var reasonStatus = map[Reason]int{
+	ReasonBadRequest:          http.StatusBadRequest,
+	ReasonUnauthorized:        http.StatusUnauthorized,
+	ReasonForbidden:           http.StatusForbidden,
+	ReasonNotFound:            http.StatusNotFound,
+	ReasonConflict:            http.StatusConflict,
+	ReasonTooLarge:            http.StatusRequestEntityTooLarge,
+	ReasonTooManyRequests:     http.StatusTooManyRequests,
+	ReasonValidationFailed:    http.StatusUnprocessableEntity,
+	ReasonProviderUnavailable: http.StatusBadGateway,
+	ReasonTimeout:             http.StatusGatewayTimeout,
+	ReasonInternal:            http.StatusInternalServerError,
+}
+
+// Error is an error of the apis with its reason and http status.
+type Error struct {
+	Reason Reason
+	Status int
+	Err    error
+
+	// Details are written with the error, e.g. the invalid fields.
+	Details any
+}
+
+// NewError returns the Error of reason, with the http status of the reason.
+func NewError(reason Reason, err error) *Error {
+	status, ok := reasonStatus[reason]
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+
+	return &Error{Reason: reason, Status: status, Err: err}
+}
+
+// NewErrorWithStatus returns the Error of the http status, e.g. a status returned
+// by a provider.
+func NewErrorWithStatus(status int, err error) *Error {
+	return &Error{Reason: ReasonForStatus(status), Status: status, Err: err}
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// WithDetails sets the details written with the error.
+func (e *Error) WithDetails(details any) *Error {
+	e.Details = details
+	return e
+}
+
+// Retryable returns whether the same request may succeed later.
+func (e *Error) Retryable() bool {
+	switch e.Reason {
+	case ReasonProviderUnavailable, ReasonTimeout, ReasonTooManyRequests:
+		return true
+	}
+
+	return false
+}
+
+// ReasonForStatus returns the reason of the http status.
+func ReasonForStatus(status int) Reason {
+	switch status {
+	case http.StatusBadRequest:
+		return ReasonBadRequest
+	case http.StatusUnauthorized:
+		return ReasonUnauthorized
+	case http.StatusForbidden:
+		return ReasonForbidden
+	case http.StatusNotFound:
+		return ReasonNotFound
+	case http.StatusConflict:
+		return ReasonConflict
+	case http.StatusRequestEntityTooLarge:
+		return ReasonTooLarge
+	case http.StatusUnprocessableEntity:
+		return ReasonValidationFailed
+	case http.StatusTooManyRequests:
+		return ReasonTooManyRequests
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return ReasonProviderUnavailable
+	case http.StatusGatewayTimeout, http.StatusRequestTimeout:
+		return ReasonTimeout
+	}
+
+	if status >= 400 && status < 500 {
+		return ReasonBadRequest
+	}
+
+	return ReasonInternal
+}
+
+// ErrorFrom returns the Error of err, the reason is inferred from err if it's not
+// an Error, ReasonInternal if unknown.
+func ErrorFrom(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+
+	var (
+		status     apierrors.APIStatus
+		serviceErr restful.ServiceError
+		netErr     net.Error
+		dnsErr     *net.DNSError
+	)
+	switch {
+	case errors.Is(err, ErrResourceNotFound):
+		return NewError(ReasonNotFound, err)
+	case errors.Is(err, context.DeadlineExceeded):
+		return NewError(ReasonTimeout, err)
+	case errors.As(err, &status):
+		return NewErrorWithStatus(int(status.Status().Code), err)
+	case errors.As(err, &serviceErr):
+		return NewErrorWithStatus(serviceErr.Code, err)
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return NewError(ReasonTimeout, err)
+	case errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.ECONNRESET), errors.As(err, &dnsErr):
+		return NewError(ReasonProviderUnavailable, err)
+	}
+
+	return NewError(ReasonInternal, err)
+}
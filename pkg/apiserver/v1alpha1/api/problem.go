@@ -0,0 +1,60 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"bytetrade.io/web3os/system-server/pkg/features"
+)
+
+// MIME_PROBLEM_JSON is the media type of the problem details.
+const MIME_PROBLEM_JSON = "application/problem+json"
+
+// Problem is the problem details of an Error, RFC 7807, with the reason as an
+// extension member.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+
+	Reason    Reason `json:"reason"`
+	Retryable bool   `json:"retryable"`
+	Details   any    `json:"details,omitempty"`
+}
+
+// ProblemDetails returns whether the errors are written as problem details, or
+// in the compatibility mode, the legacy envelope and plain text.
+func ProblemDetails() bool {
+	return features.Enabled(features.ProblemDetails)
+}
+
+// NewProblem returns the problem details of e, instance is the path of the request
+// if known.
+func NewProblem(e *Error, instance string) *Problem {
+	return &Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(e.Status),
+		Status:    e.Status,
+		Detail:    e.Error(),
+		Instance:  instance,
+		Reason:    e.Reason,
+		Retryable: e.Retryable(),
+		Details:   e.Details,
+	}
+}
+
+// WriteProblem writes e as the problem details with its http status.
+func WriteProblem(w http.ResponseWriter, e *Error, instance string) {
+	data, err := json.Marshal(NewProblem(e, instance))
+	if err != nil {
+		http.Error(w, sanitizer.Replace(e.Error()), e.Status)
+		return
+	}
+
+	w.Header().Set("Content-Type", MIME_PROBLEM_JSON)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(e.Status)
+	_, _ = w.Write(data)
+}
@@ -2,4 +2,5 @@ package response
 
 const (
 	tokenInvalidErrorCode = 100001
+	validationErrorCode   = 100002
 )
@@ -1,9 +1,12 @@
 package response
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 
+	"bytetrade.io/web3os/system-server/pkg/apiserver/v1alpha1/api"
+
 	"github.com/emicklei/go-restful/v3"
 )
 
@@ -12,43 +15,72 @@ var successMsg = "success"
 type Header struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
+
+	// Reason is the reason of an error, see api.Reason.
+	Reason string `json:"reason,omitempty"`
 }
 
 type Response struct {
 	Header
 
 	Data any `json:"data,omitempty"` // data field, optional, object or list
+
+	Page any `json:"page,omitempty"` // page of a list, optional
 }
 
 func (s Header) Error() string {
 	return fmt.Sprintf("ServiceError[%v]:%v", s.Code, s.Message)
 }
 
-func errHandle(code int, w *restful.Response, err error) {
-	var text string
+func errHandle(w *restful.Response, e *api.Error) {
+	if api.ProblemDetails() {
+		api.WriteProblem(w, e, "")
+		return
+	}
 
-	switch e := err.(type) {
-	case TokenValidationError:
+	code := 1
+	var tokenErr TokenValidationError
+	switch {
+	case errors.As(e, &tokenErr):
 		code = tokenInvalidErrorCode
-		text = e.Error()
-	default:
-		code = 1
-		text = err.Error()
+	case e.Reason == api.ReasonValidationFailed && e.Details != nil:
+		code = validationErrorCode
 	}
 
-	// code is all to 200
-	w.WriteHeaderAndEntity(http.StatusOK, Header{
-		Code:    code,
-		Message: text,
+	// code is all to 200 in the compatibility mode
+	w.WriteHeaderAndEntity(http.StatusOK, Response{
+		Header: Header{
+			Code:    code,
+			Message: e.Error(),
+			Reason:  string(e.Reason),
+		},
+		Data: e.Details,
 	})
 }
 
 func HandleForbidden(w *restful.Response, err error) {
-	errHandle(http.StatusForbidden, w, err)
+	errHandle(w, api.NewError(api.ReasonForbidden, err))
 }
 
+// HandleError writes the error with the reason of it, see api.ErrorFrom.
 func HandleError(w *restful.Response, err error) {
-	errHandle(http.StatusInternalServerError, w, err)
+	var tokenErr TokenValidationError
+	if errors.As(err, &tokenErr) {
+		errHandle(w, api.NewError(api.ReasonUnauthorized, err))
+		return
+	}
+
+	errHandle(w, api.ErrorFrom(err))
+}
+
+// HandleBadRequest writes the error of an invalid request.
+func HandleBadRequest(w *restful.Response, err error) {
+	errHandle(w, api.NewError(api.ReasonBadRequest, err))
+}
+
+// HandleValidationError writes the error with the details of the invalid fields.
+func HandleValidationError(w *restful.Response, err error, details any) {
+	errHandle(w, api.NewError(api.ReasonValidationFailed, err).WithDetails(details))
 }
 
 // Success writes data to response with http.StatusOK.
@@ -71,3 +103,15 @@ func SuccessNoData(w *restful.Response) {
 		},
 	})
 }
+
+// SuccessWithPage writes a page of list to response with http.StatusOK.
+func SuccessWithPage(w *restful.Response, v any, page any) {
+	w.WriteHeaderAndEntity(http.StatusOK, Response{
+		Header: Header{
+			Code:    0,
+			Message: successMsg,
+		},
+		Data: v,
+		Page: page,
+	})
+}
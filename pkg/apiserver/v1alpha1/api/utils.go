@@ -6,7 +6,6 @@ import (
 	"strings"
 
 	"github.com/emicklei/go-restful/v3"
-	"k8s.io/apimachinery/pkg/api/errors"
 	ctrl "sigs.k8s.io/controller-runtime"
 )
 
@@ -14,55 +13,57 @@ import (
 var sanitizer = strings.NewReplacer(`&`, "&amp;", `<`, "&lt;", `>`, "&gt;")
 
 func HandleInternalError(response *restful.Response, req *restful.Request, err error) {
-	handle(http.StatusInternalServerError, response, req, err)
+	handle(response, req, NewError(ReasonInternal, err))
 }
 
 // HandleBadRequest writes http.StatusBadRequest and log error
 func HandleBadRequest(response *restful.Response, req *restful.Request, err error) {
-	handle(http.StatusBadRequest, response, req, err)
+	handle(response, req, NewError(ReasonBadRequest, err))
 }
 
 // HandleNotFound writes http.StatusNotFound and log error.
 func HandleNotFound(response *restful.Response, req *restful.Request, err error) {
-	handle(http.StatusNotFound, response, req, err)
+	handle(response, req, NewError(ReasonNotFound, err))
 }
 
 // HandleForbidden writes http.StatusForbidden and log error.
 func HandleForbidden(response *restful.Response, req *restful.Request, err error) {
-	handle(http.StatusForbidden, response, req, err)
+	handle(response, req, NewError(ReasonForbidden, err))
 }
 
 // HandleUnauthorized writes http.StatusUnauthorized and log error.
 func HandleUnauthorized(response *restful.Response, req *restful.Request, err error) {
-	handle(http.StatusUnauthorized, response, req, err)
+	handle(response, req, NewError(ReasonUnauthorized, err))
 }
 
 // HandleTooManyRequests writes http.StatusTooManyRequests and log error.
 func HandleTooManyRequests(response *restful.Response, req *restful.Request, err error) {
-	handle(http.StatusTooManyRequests, response, req, err)
+	handle(response, req, NewError(ReasonTooManyRequests, err))
+}
+
+// HandleRequestEntityTooLarge writes http.StatusRequestEntityTooLarge and log error.
+func HandleRequestEntityTooLarge(response *restful.Response, req *restful.Request, err error) {
+	handle(response, req, NewError(ReasonTooLarge, err))
 }
 
 // HandleConflict writes http.StatusConflict and log error.
 func HandleConflict(response *restful.Response, req *restful.Request, err error) {
-	handle(http.StatusConflict, response, req, err)
+	handle(response, req, NewError(ReasonConflict, err))
 }
 
 // HandleError handles the given error by determining the appropriate HTTP status code and performing error handling logic.
 func HandleError(response *restful.Response, req *restful.Request, err error) {
-	var statusCode int
-	switch t := err.(type) {
-	case errors.APIStatus:
-		statusCode = int(t.Status().Code)
-	case restful.ServiceError:
-		statusCode = t.Code
-	default:
-		statusCode = http.StatusInternalServerError
-	}
-	handle(statusCode, response, req, err)
+	handle(response, req, ErrorFrom(err))
 }
 
-func handle(statusCode int, response *restful.Response, req *restful.Request, err error) {
+func handle(response *restful.Response, req *restful.Request, e *Error) {
 	_, fn, line, _ := runtime.Caller(2)
-	ctrl.Log.Error(err, "response error", "func", fn, "line", line)
-	http.Error(response, sanitizer.Replace(err.Error()), statusCode)
+	ctrl.Log.Error(e.Err, "response error", "func", fn, "line", line, "reason", e.Reason)
+
+	if !ProblemDetails() {
+		http.Error(response, sanitizer.Replace(e.Error()), e.Status)
+		return
+	}
+
+	WriteProblem(response, e, req.Request.URL.Path)
 }
@@ -2,18 +2,27 @@ package apiserver
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"time"
 
+	legacy "bytetrade.io/web3os/system-server/pkg/apiserver/v1alpha1/legacy/v1alpha1"
 	"bytetrade.io/web3os/system-server/pkg/constants"
+	"bytetrade.io/web3os/system-server/pkg/features"
 	sysclientset "bytetrade.io/web3os/system-server/pkg/generated/clientset/versioned"
 	"bytetrade.io/web3os/system-server/pkg/generated/listers/sys/v1alpha1"
+	"bytetrade.io/web3os/system-server/pkg/metrics"
 	permission "bytetrade.io/web3os/system-server/pkg/permission/v1alpha1"
 	permissionv2alpha1 "bytetrade.io/web3os/system-server/pkg/permission/v2alpha1"
+	"bytetrade.io/web3os/system-server/pkg/pki"
+	prodiverregistry "bytetrade.io/web3os/system-server/pkg/providerregistry/v1alpha1"
 	providerv2alpha1 "bytetrade.io/web3os/system-server/pkg/providerregistry/v2alpha1"
+	serviceproxy "bytetrade.io/web3os/system-server/pkg/serviceproxy/v1alpha1"
 	proxyv2alpha1 "bytetrade.io/web3os/system-server/pkg/serviceproxy/v2alpha1"
 
 	"github.com/emicklei/go-restful/v3"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/rest"
 	"k8s.io/klog/v2"
@@ -24,6 +33,10 @@ type APIServer struct {
 	Server   *http.Server
 	preStart func()
 
+	// TLSServer serves the same apis with the certificate of the internal CA,
+	// nil if mTLS is disabled.
+	TLSServer *http.Server
+
 	// RESTful Server
 	container *restful.Container
 
@@ -58,25 +71,70 @@ func (s *APIServer) PrepareRun(
 		return err
 	}
 
+	s.container.Filter(traceRequest)
 	s.container.Filter(logRequestAndResponse)
+	s.container.Filter(recordMetrics)
 	s.container.Router(restful.CurlyRouter{})
 	s.container.RecoverHandler(func(panicReason interface{}, httpWriter http.ResponseWriter) {
 		logStackOnRecover(panicReason, httpWriter)
 	})
 
-	// registry := prodiverregistry.NewRegistry(sysclientset, providerLister)
+	registry := prodiverregistry.NewRegistry(sysclientset, providerLister)
 	ctrlSet := permission.PermissionControlSet{
 		Ctrl: permission.NewPermissionControl(sysclientset, permissionLister),
 		Mgr:  permission.NewAccessManager(),
 	}
 
+	requireAuth := permissionv2alpha1.Auth(proxy.Authenticator())
+
 	// use the server context for goroutine in background
-	utilruntime.Must(permission.AddPermissionControlToContainer(s.container, &ctrlSet, kubeconfig))
-	utilruntime.Must(permissionv2alpha1.AddPermissionControlToContainer(s.container, permissionv2alpha1.Auth(proxy.Authenticator()), kubeconfig))
-	utilruntime.Must(providerv2alpha1.AddProviderRegistryToContainer(s.container, permissionv2alpha1.Auth(proxy.Authenticator()), kubeconfig))
+	if features.Enabled(features.PermissionV1) {
+		utilruntime.Must(permission.AddPermissionControlToContainer(s.container, &ctrlSet, kubeconfig))
+	}
+	if features.Enabled(features.PermissionV2) {
+		utilruntime.Must(permissionv2alpha1.AddPermissionControlToContainer(s.container, requireAuth, kubeconfig,
+			proxy.Explainer().WithAccessTokens(&ctrlSet)))
+	}
+	if features.Enabled(features.ProviderV2) {
+		utilruntime.Must(providerv2alpha1.AddProviderRegistryToContainer(s.container, requireAuth, kubeconfig))
+	}
+	if features.Enabled(features.DataAPI) {
+		utilruntime.Must(AddDataAPIToContainer(s.serverCtx, s.container, kubeconfig, registry, &ctrlSet, requireAuth, DataAPIOptions{}))
+	}
+	if features.Enabled(features.LegacyAPIV1) {
+		utilruntime.Must(legacy.AddLegacyAPIToContainer(s.container, registry))
+	}
+	if features.Enabled(features.LegacyAPIV2) {
+		utilruntime.Must(legacy.AddLegacyAPIV2ToContainer(s.container, registry))
+	}
+
+	// the openapi spec is built from the web services added above
+	utilruntime.Must(addOpenAPIToContainer(s.container, registry, &ctrlSet))
+	s.container.Handle("/metrics", metrics.Handler())
+
 	s.Server.Handler = s.container
+	if features.Enabled(features.LegacyAPIV2) {
+		// the grpc calls to the legacy_api providers come in HTTP/2, in cleartext behind the ingress
+		s.Server.Handler = h2c.NewHandler(legacy.NewGRPCHandler(registry, s.container), &http2.Server{})
+	}
+	// the hijacked websocket connections are not closed by the server shutdown
+	s.Server.RegisterOnShutdown(serviceproxy.CloseWebsockets)
+
+	if tlsConfig := pki.ServerTLSConfig(); tlsConfig != nil {
+		s.TLSServer = &http.Server{
+			Addr:      constants.APIServerTLSListenAddress,
+			Handler:   s.Server.Handler,
+			TLSConfig: tlsConfig,
+		}
+		s.TLSServer.RegisterOnShutdown(serviceproxy.CloseWebsockets)
+	}
 
 	s.preStart = func() {
+		if !features.Enabled(features.RBACProxy) {
+			klog.Info("rbac proxy is disabled")
+			return
+		}
+
 		go func() {
 			utilruntime.Must(proxy.Start(proxyCfg))
 		}()
@@ -94,6 +152,9 @@ func (s *APIServer) Run() error {
 
 	go func() {
 		<-s.serverCtx.Done()
+		if s.TLSServer != nil {
+			_ = s.TLSServer.Shutdown(shutdownCtx)
+		}
 		_ = s.Server.Shutdown(shutdownCtx)
 		klog.Info("shutdown apiserver for system-server")
 	}()
@@ -102,6 +163,16 @@ func (s *APIServer) Run() error {
 		s.preStart()
 	}
 
+	if s.TLSServer != nil {
+		go func() {
+			klog.Info("starting tls apiserver for system-server,", "listen on ", constants.APIServerTLSListenAddress)
+			// the certificate is from the tls config
+			if err := s.TLSServer.ListenAndServeTLS("", ""); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				klog.Error("tls apiserver error, ", err)
+			}
+		}()
+	}
+
 	klog.Info("starting apiserver for system-server,", "listen on ", constants.APIServerListenAddress)
 	return s.Server.ListenAndServe()
 }
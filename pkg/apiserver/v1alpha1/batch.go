@@ -0,0 +1,202 @@
+package apiserver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	sysv1alpha1 "bytetrade.io/web3os/system-server/pkg/apis/sys/v1alpha1"
+	"bytetrade.io/web3os/system-server/pkg/apiserver/v1alpha1/api"
+	"bytetrade.io/web3os/system-server/pkg/apiserver/v1alpha1/api/response"
+	permission "bytetrade.io/web3os/system-server/pkg/permission/v1alpha1"
+	serviceproxy "bytetrade.io/web3os/system-server/pkg/serviceproxy/v1alpha1"
+
+	"github.com/emicklei/go-restful/v3"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// MaxBatchOperations is the max number of operations in a batch request.
+	MaxBatchOperations = 200
+
+	// BatchConcurrency is the number of operations of a batch invoked concurrently.
+	BatchConcurrency = 8
+)
+
+// BatchOperation is a single data operation in a batch, it's equivalent to a request
+// to the data api with the same op, data type, group and version.
+type BatchOperation struct {
+	// ID is an optional id set by the client to correlate the results.
+	ID       string `json:"id,omitempty"`
+	Op       string `json:"op"`
+	DataType string `json:"datatype"`
+	Group    string `json:"group"`
+	Version  string `json:"version"`
+	// DataID is required by Get, Update and Delete.
+	DataID string `json:"dataid,omitempty"`
+	// Filters and Page are the query of List, Page.Continue is the continue of
+	// the last page.
+	Filters map[string][]string      `json:"filters,omitempty"`
+	Page    *serviceproxy.Pagination `json:"page,omitempty"`
+	// Data is the body of Create, Update, Delete and custom actions.
+	Data map[string]interface{} `json:"data,omitempty"`
+}
+
+type BatchRequest struct {
+	Operations []BatchOperation `json:"operations"`
+}
+
+// BatchResult is the result of an operation, in the same order as the operations.
+type BatchResult struct {
+	ID string `json:"id,omitempty"`
+	// Status is the http status of the operation.
+	Status  int    `json:"status"`
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	// Reason is the reason of a failed operation, see api.Reason.
+	Reason    api.Reason `json:"reason,omitempty"`
+	Retryable bool       `json:"retryable,omitempty"`
+	Data      any        `json:"data,omitempty"`
+	// Page is the page of List result, if the provider pages it.
+	Page *serviceproxy.ListPage `json:"page,omitempty"`
+}
+
+type BatchResponse struct {
+	Results []*BatchResult `json:"results"`
+}
+
+// batch invokes a list of data operations, each one is authorized by the access
+// token individually, and failing operations don't fail the others.
+func (h *Handler) batch(req *restful.Request, resp *restful.Response) {
+	var batchReq BatchRequest
+	if err := req.ReadEntity(&batchReq); err != nil {
+		response.HandleBadRequest(resp, err)
+		return
+	}
+
+	if len(batchReq.Operations) == 0 {
+		response.HandleBadRequest(resp, errors.New("no operations in batch"))
+		return
+	}
+
+	if len(batchReq.Operations) > MaxBatchOperations {
+		response.HandleBadRequest(resp, fmt.Errorf("too many operations in batch, max %d", MaxBatchOperations))
+		return
+	}
+
+	token := req.Request.Header.Get(api.AccessTokenHeader)
+	results := make([]*BatchResult, len(batchReq.Operations))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, BatchConcurrency)
+	for i := range batchReq.Operations {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			results[i] = h.doBatchOperation(req, token, &batchReq.Operations[i])
+		}(i)
+	}
+	wg.Wait()
+
+	response.Success(resp, BatchResponse{Results: results})
+}
+
+func (h *Handler) doBatchOperation(req *restful.Request, token string, operation *BatchOperation) *BatchResult {
+	result := &BatchResult{ID: operation.ID}
+	fail := func(e *api.Error) *BatchResult {
+		result.Status = e.Status
+		result.Code = 1
+		result.Message = e.Error()
+		result.Reason = e.Reason
+		result.Retryable = e.Retryable()
+		result.Data = e.Details
+		return result
+	}
+
+	if operation.Op == "" || operation.DataType == "" || operation.Group == "" || operation.Version == "" {
+		return fail(api.NewError(api.ReasonBadRequest, errors.New("op, datatype, group and version are required")))
+	}
+
+	appKey, err := permission.ValidateAccessToken(token, operation.Op,
+		operation.DataType, operation.Version, operation.Group, h.permissionCtrl)
+	if err != nil {
+		return fail(api.NewError(api.ReasonForbidden, err))
+	}
+
+	proxyrequest, err := newBatchProxyRequest(appKey, token, operation)
+	if err != nil {
+		return fail(api.NewError(api.ReasonBadRequest, err))
+	}
+
+	ret, _, err := h.proxy.DoRequest(req, operation.Op, proxyrequest)
+	if err != nil {
+		klog.Error("batch operation ", operation.Op, " on ", operation.DataType, " error, ", err)
+		return fail(api.ErrorFrom(err))
+	}
+
+	// notify watcher
+	switch operation.Op {
+	case sysv1alpha1.Create, sysv1alpha1.Update, sysv1alpha1.Delete:
+		h.dispatcher.DoWatch(req.Request.Context(), serviceproxy.NewDispatchRequest(proxyrequest, ret))
+
+	case sysv1alpha1.List:
+		result.Page = serviceproxy.NewListPage(ret)
+	}
+
+	result.Status = http.StatusOK
+	result.Message = "success"
+	result.Data = ret
+	return result
+}
+
+// newBatchProxyRequest constructs the ProxyRequest as NewProxyRequestFromOpRequest
+// does for the single request.
+func newBatchProxyRequest(appKey, token string, operation *BatchOperation) (*serviceproxy.ProxyRequest, error) {
+	var param, data interface{}
+
+	switch operation.Op {
+	case sysv1alpha1.Get:
+		if operation.DataID == "" {
+			return nil, errors.New("dataid is required")
+		}
+		param = serviceproxy.GetOpParam{DataID: operation.DataID}
+
+	case sysv1alpha1.List:
+		listParam := serviceproxy.ListOpParam{Filters: operation.Filters}
+		if operation.Page != nil {
+			listParam.Page = *operation.Page
+		}
+		param = listParam
+
+	default:
+		if operation.Data == nil {
+			return nil, errors.New("data is required")
+		}
+		data = operation.Data
+
+		if operation.Op == sysv1alpha1.Update || operation.Op == sysv1alpha1.Delete {
+			if operation.DataID == "" {
+				return nil, errors.New("dataid is required")
+			}
+			param = serviceproxy.UpdateOpParam{DataID: operation.DataID}
+		}
+	}
+
+	return &serviceproxy.ProxyRequest{
+		Op:       operation.Op,
+		DataType: operation.DataType,
+		Version:  operation.Version,
+		Group:    operation.Group,
+		AppKey:   appKey,
+		Param:    param,
+		Data:     data,
+		Token:    token,
+	}, nil
+}
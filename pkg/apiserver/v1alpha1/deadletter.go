@@ -0,0 +1,88 @@
+package apiserver
+
+import (
+	"errors"
+	"strconv"
+
+	"bytetrade.io/web3os/system-server/pkg/apiserver/v1alpha1/api"
+	"bytetrade.io/web3os/system-server/pkg/apiserver/v1alpha1/api/response"
+	serviceproxy "bytetrade.io/web3os/system-server/pkg/serviceproxy/v1alpha1"
+
+	"github.com/emicklei/go-restful/v3"
+	"k8s.io/klog/v2"
+)
+
+const ParamDeliveryID = "delivery"
+
+func (h *Handler) listDeadLetters(req *restful.Request, resp *restful.Response) {
+	if ok, _ := h.Validate(req, resp); !ok {
+		return
+	}
+
+	deliveries, err := h.dispatcher.DeadLetters()
+	if err != nil {
+		api.HandleError(resp, req, err)
+		return
+	}
+
+	response.Success(resp, deliveries)
+}
+
+func (h *Handler) getDeadLetter(req *restful.Request, resp *restful.Response) {
+	h.withDeadLetter(req, resp, func(id int64) {
+		delivery, err := h.dispatcher.DeadLetter(id)
+		if err != nil {
+			handleDeadLetterError(req, resp, err)
+			return
+		}
+
+		response.Success(resp, delivery)
+	})
+}
+
+func (h *Handler) redriveDeadLetter(req *restful.Request, resp *restful.Response) {
+	h.withDeadLetter(req, resp, func(id int64) {
+		if err := h.dispatcher.Redrive(id); err != nil {
+			handleDeadLetterError(req, resp, err)
+			return
+		}
+
+		klog.Info("dead letter redrived, ", id)
+		response.SuccessNoData(resp)
+	})
+}
+
+func (h *Handler) discardDeadLetter(req *restful.Request, resp *restful.Response) {
+	h.withDeadLetter(req, resp, func(id int64) {
+		if err := h.dispatcher.Discard(id); err != nil {
+			handleDeadLetterError(req, resp, err)
+			return
+		}
+
+		klog.Info("dead letter discarded, ", id)
+		response.SuccessNoData(resp)
+	})
+}
+
+func (h *Handler) withDeadLetter(req *restful.Request, resp *restful.Response, next func(id int64)) {
+	if ok, _ := h.Validate(req, resp); !ok {
+		return
+	}
+
+	id, err := strconv.ParseInt(req.PathParameter(ParamDeliveryID), 10, 64)
+	if err != nil {
+		api.HandleBadRequest(resp, req, err)
+		return
+	}
+
+	next(id)
+}
+
+func handleDeadLetterError(req *restful.Request, resp *restful.Response, err error) {
+	if errors.Is(err, serviceproxy.ErrDeliveryNotFound) {
+		api.HandleNotFound(resp, req, err)
+		return
+	}
+
+	api.HandleError(resp, req, err)
+}
@@ -0,0 +1,101 @@
+package apiserver
+
+import (
+	"sort"
+
+	sysv1alpha1 "bytetrade.io/web3os/system-server/pkg/apis/sys/v1alpha1"
+	"bytetrade.io/web3os/system-server/pkg/apiserver/v1alpha1/api"
+	"bytetrade.io/web3os/system-server/pkg/apiserver/v1alpha1/api/response"
+	permission "bytetrade.io/web3os/system-server/pkg/permission/v1alpha1"
+
+	"github.com/emicklei/go-restful/v3"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// DiscoveryOp is an op of data type the caller can access.
+type DiscoveryOp struct {
+	Name           string                `json:"name"`
+	RequestSchema  *runtime.RawExtension `json:"requestSchema,omitempty"`
+	ResponseSchema *runtime.RawExtension `json:"responseSchema,omitempty"`
+	// Cached is true if the responses are cached by system-server.
+	Cached bool `json:"cached,omitempty"`
+}
+
+// DiscoveryDataType is a data type served by an active provider.
+type DiscoveryDataType struct {
+	DataType    string        `json:"datatype"`
+	Group       string        `json:"group"`
+	Version     string        `json:"version"`
+	Description string        `json:"description,omitempty"`
+	Ops         []DiscoveryOp `json:"ops"`
+	// SchemaConfigMap holds the schemas of ops not declared inline.
+	SchemaConfigMap string `json:"schemaConfigMap,omitempty"`
+}
+
+type DiscoveryResponse struct {
+	DataTypes []DiscoveryDataType `json:"datatypes"`
+}
+
+// discovery lists the data types of active providers, with only the ops the
+// caller's access token is permitted.
+func (h *Handler) discovery(req *restful.Request, resp *restful.Response) {
+	token := req.Request.Header.Get(api.AccessTokenHeader)
+
+	providers, err := h.registry.ListProviders(req.Request.Context())
+	if err != nil {
+		response.HandleError(resp, err)
+		return
+	}
+
+	// checked for every op of every provider, so it must not touch the token
+	allowed := func(op string, pr *sysv1alpha1.ProviderRegistry) bool {
+		return permission.AccessTokenAllows(token, op, pr.Spec.DataType, pr.Spec.Version, pr.Spec.Group, h.permissionCtrl)
+	}
+
+	datatypes := make([]DiscoveryDataType, 0)
+	for _, pr := range providers {
+		dt := DiscoveryDataType{
+			DataType:        pr.Spec.DataType,
+			Group:           pr.Spec.Group,
+			Version:         pr.Spec.Version,
+			Description:     pr.Spec.Description,
+			SchemaConfigMap: pr.Spec.SchemaConfigMap,
+			Ops:             make([]DiscoveryOp, 0),
+		}
+
+		for _, opApi := range pr.Spec.OpApis {
+			if !allowed(opApi.Name, pr) {
+				continue
+			}
+
+			dt.Ops = append(dt.Ops, DiscoveryOp{
+				Name:           opApi.Name,
+				RequestSchema:  opApi.RequestSchema,
+				ResponseSchema: opApi.ResponseSchema,
+				Cached:         opApi.CacheTTL.Duration > 0,
+			})
+		}
+
+		// Watch is served by system-server itself
+		if allowed(sysv1alpha1.Watch, pr) {
+			dt.Ops = append(dt.Ops, DiscoveryOp{Name: sysv1alpha1.Watch})
+		}
+
+		if len(dt.Ops) > 0 {
+			datatypes = append(datatypes, dt)
+		}
+	}
+
+	sort.Slice(datatypes, func(i, j int) bool {
+		a, b := datatypes[i], datatypes[j]
+		if a.DataType != b.DataType {
+			return a.DataType < b.DataType
+		}
+		if a.Group != b.Group {
+			return a.Group < b.Group
+		}
+		return a.Version < b.Version
+	})
+
+	response.Success(resp, DiscoveryResponse{DataTypes: datatypes})
+}
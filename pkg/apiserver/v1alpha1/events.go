@@ -0,0 +1,61 @@
+package apiserver
+
+import (
+	"errors"
+	"strconv"
+
+	sysv1alpha1 "bytetrade.io/web3os/system-server/pkg/apis/sys/v1alpha1"
+	"bytetrade.io/web3os/system-server/pkg/apiserver/v1alpha1/api"
+	"bytetrade.io/web3os/system-server/pkg/apiserver/v1alpha1/api/response"
+	permission "bytetrade.io/web3os/system-server/pkg/permission/v1alpha1"
+
+	"github.com/emicklei/go-restful/v3"
+)
+
+const (
+	ParamCursor = "cursor"
+	ParamLimit  = "limit"
+)
+
+// events replays the dispatched events of the data type after the cursor, the
+// caller requires the permission of Watch op. A watcher backfills with cursor 0,
+// and resumes from the cursor of the last event it has received.
+func (h *Handler) events(req *restful.Request, resp *restful.Response) {
+	token := req.Request.Header.Get(api.AccessTokenHeader)
+	_, err := permission.ValidateAccessTokenWithRequest(token, sysv1alpha1.Watch, req, h.permissionCtrl)
+	if err != nil {
+		response.HandleForbidden(resp, err)
+		return
+	}
+
+	var cursor int64
+	if c := req.QueryParameter(ParamCursor); c != "" {
+		cursor, err = strconv.ParseInt(c, 10, 64)
+		if err != nil || cursor < 0 {
+			response.HandleBadRequest(resp, errors.New("invalid cursor"))
+			return
+		}
+	}
+
+	var limit int
+	if l := req.QueryParameter(ParamLimit); l != "" {
+		limit, err = strconv.Atoi(l)
+		if err != nil {
+			response.HandleBadRequest(resp, errors.New("invalid limit"))
+			return
+		}
+	}
+
+	list, err := h.dispatcher.Events(
+		req.PathParameter(api.ParamDataType),
+		req.PathParameter(api.ParamGroup),
+		req.PathParameter(api.ParamVersion),
+		cursor, limit,
+	)
+	if err != nil {
+		response.HandleError(resp, err)
+		return
+	}
+
+	response.Success(resp, list)
+}
@@ -5,13 +5,21 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"runtime"
+	"strconv"
+	"strings"
 	"time"
 
 	"bytetrade.io/web3os/system-server/pkg/apiserver/v1alpha1/api"
+	"bytetrade.io/web3os/system-server/pkg/metrics"
+	"bytetrade.io/web3os/system-server/pkg/tracing"
 	"bytetrade.io/web3os/system-server/pkg/utils"
 
 	"github.com/emicklei/go-restful/v3"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 	"k8s.io/klog/v2"
 )
 
@@ -49,7 +57,7 @@ func logRequestAndResponse(req *restful.Request, resp *restful.Response, chain *
 	logWithVerbose.Infof("%s - \"%s %s %s\" %d %d %dms",
 		utils.RemoteIP(req.Request),
 		req.Request.Method,
-		req.Request.URL,
+		redactURL(req.Request.URL),
 		req.Request.Proto,
 		resp.StatusCode(),
 		resp.ContentLength(),
@@ -58,6 +66,63 @@ func logRequestAndResponse(req *restful.Request, resp *restful.Response, chain *
 
 }
 
+// redactURL returns the url with the credentials in the query redacted.
+func redactURL(u *url.URL) string {
+	query := u.Query()
+	if !query.Has(ParamTicket) {
+		return u.String()
+	}
+
+	query.Set(ParamTicket, "REDACTED")
+	redacted := *u
+	redacted.RawQuery = query.Encode()
+	return redacted.String()
+}
+
+// recordMetrics records the requests by the route template, the requests of no
+// route are recorded as unmatched.
+func recordMetrics(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+	start := time.Now()
+	chain.ProcessFilter(req, resp)
+
+	route := req.SelectedRoutePath()
+	if route == "" {
+		route = "unmatched"
+	}
+	method := metrics.Method(req.Request.Method)
+
+	metrics.HTTPRequests.WithLabelValues(route, method, strconv.Itoa(resp.StatusCode())).Inc()
+	metrics.HTTPRequestDuration.WithLabelValues(route, method).Observe(time.Since(start).Seconds())
+}
+
+// traceRequest starts the server span of the request, as the child of the span
+// of the caller in the traceparent header if any.
+func traceRequest(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+	route := req.SelectedRoutePath()
+	if route == "" {
+		route = "unmatched"
+	}
+	method := metrics.Method(req.Request.Method)
+
+	ctx := tracing.Extract(req.Request.Context(), req.Request.Header)
+	ctx, span := tracing.Start(ctx, method+" "+route,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(method),
+			semconv.HTTPRoute(route),
+			semconv.URLPath(req.Request.URL.Path),
+		))
+	defer span.End()
+
+	req.Request = req.Request.WithContext(ctx)
+	chain.ProcessFilter(req, resp)
+
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode()))
+	if resp.StatusCode() >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(resp.StatusCode()))
+	}
+}
+
 // func (h *Handler) createClientSet(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
 // 	kubeconfig := newKubeConfigFromRequest(req, h.kubeHost)
 // 	client, err := clientset.NewClientSet(kubeconfig)
@@ -73,7 +138,8 @@ func logRequestAndResponse(req *restful.Request, resp *restful.Response, chain *
 func (h *Handler) authenticate(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
 	// Ignore uris, because do not need authentication
 	trustPaths := []string{
-		"/system-server/v1alpha1/apidocs.json",
+		APIDocsPath,
+		APIDocsV3Path,
 	}
 
 	needAuth := true
@@ -86,6 +152,11 @@ func (h *Handler) authenticate(req *restful.Request, resp *restful.Response, cha
 
 	if needAuth {
 		token := req.Request.Header.Get(api.AccessTokenHeader)
+		if token == "" && strings.HasSuffix(req.SelectedRoutePath(), watchPath) {
+			// the ticket is checked and used up by the watch
+			token = req.QueryParameter(ParamTicket)
+		}
+
 		if token == "" {
 			api.HandleUnauthorized(resp, req, errors.New("no authentication token error"))
 			return
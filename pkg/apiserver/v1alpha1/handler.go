@@ -6,36 +6,112 @@ import (
 	sysv1alpha1 "bytetrade.io/web3os/system-server/pkg/apis/sys/v1alpha1"
 	"bytetrade.io/web3os/system-server/pkg/apiserver/v1alpha1/api"
 	"bytetrade.io/web3os/system-server/pkg/apiserver/v1alpha1/api/response"
+	"bytetrade.io/web3os/system-server/pkg/constants"
 	permission "bytetrade.io/web3os/system-server/pkg/permission/v1alpha1"
 	prodiverregistry "bytetrade.io/web3os/system-server/pkg/providerregistry/v1alpha1"
 	serviceproxy "bytetrade.io/web3os/system-server/pkg/serviceproxy/v1alpha1"
+	"bytetrade.io/web3os/system-server/pkg/utils/apitools"
+	"bytetrade.io/web3os/system-server/pkg/webhook"
 
 	"github.com/emicklei/go-restful/v3"
+	"github.com/jellydator/ttlcache/v3"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 )
 
 // Handler include several fields that used for managing interactions with associated services.
 type Handler struct {
+	*apitools.BaseHandler
 	serviceCtx     context.Context
 	kubeConfig     *rest.Config // helm's kubeconfig. TODO: insecure
+	registry       *prodiverregistry.Registry
 	proxy          *serviceproxy.Proxy
 	dispatcher     *serviceproxy.Dispatcher
 	permissionCtrl *permission.PermissionControlSet
+	watchTickets   *ttlcache.Cache[string, *watchTicket]
+}
+
+// DataAPIOptions are the dependencies of the data api, the defaults are used if
+// they're empty.
+type DataAPIOptions struct {
+	// KubeClient reads the schema ConfigMaps of providers and the Secrets of
+	// watchers, created from the kubeconfig if nil.
+	KubeClient kubernetes.Interface
+
+	// DBPath is the database of the outbox and event log, constants.DBPath if empty.
+	DBPath string
+
+	// SigningKeyPath is the key signing the watcher callbacks, constants.SigningKeyPath
+	// if empty.
+	SigningKeyPath string
+
+	// Namespace is the namespace of system-server, its owner manages the dead
+	// letters, constants.MyNamespace if empty.
+	Namespace string
 }
 
 func newAPIHandler(ctx context.Context, kubeconfig *rest.Config,
 	registry *prodiverregistry.Registry,
 	ctrlSet *permission.PermissionControlSet,
+	options DataAPIOptions,
 ) (*Handler, error) {
-	proxy := serviceproxy.NewProxy(registry)
-	dispatcher := serviceproxy.NewDispatcher(ctx, registry)
+	if options.KubeClient == nil {
+		options.KubeClient = kubernetes.NewForConfigOrDie(kubeconfig)
+	}
+	if options.DBPath == "" {
+		options.DBPath = constants.DBPath
+	}
+	if options.SigningKeyPath == "" {
+		options.SigningKeyPath = constants.SigningKeyPath
+	}
+
+	db, err := serviceproxy.OpenStore(options.DBPath)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		<-ctx.Done()
+		db.Close()
+	}()
+
+	outbox, err := serviceproxy.NewOutbox(db)
+	if err != nil {
+		return nil, err
+	}
+
+	eventLog, err := serviceproxy.NewEventLog(db, constants.EventRetentionCount, constants.EventRetentionAge)
+	if err != nil {
+		return nil, err
+	}
+
+	signingKey, err := webhook.LoadOrGenerateKey(options.SigningKeyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	cache := serviceproxy.NewResponseCache(ctx, constants.CacheMaxEntries)
+	proxy := serviceproxy.NewProxyWithOptions(registry, serviceproxy.ProxyOptions{
+		Cache:     cache,
+		Validator: serviceproxy.NewSchemaValidator(options.KubeClient),
+	})
+	dispatcher := serviceproxy.NewDispatcher(ctx, registry, outbox, serviceproxy.DispatcherOptions{
+		Workers:    constants.WatcherWorkers,
+		SigningKey: signingKey,
+		EventLog:   eventLog,
+		Cache:      cache,
+		KubeClient: options.KubeClient,
+	})
 
 	return &Handler{
+		BaseHandler:    &apitools.BaseHandler{Namespace: options.Namespace},
 		serviceCtx:     ctx,
 		kubeConfig:     kubeconfig,
+		registry:       registry,
 		proxy:          proxy,
 		dispatcher:     dispatcher,
 		permissionCtrl: ctrlSet,
+		watchTickets:   newWatchTickets(),
 	}, nil
 }
 
@@ -79,11 +155,11 @@ func (h *Handler) handleProxy(op string, req *restful.Request, resp *restful.Res
 
 	proxyrequest, err := serviceproxy.NewProxyRequestFromOpRequest(appKey, op, req)
 	if err != nil {
-		response.HandleError(resp, err)
+		response.HandleBadRequest(resp, err)
 		return
 	}
 
-	// invoke provider
+	// invoke provider, the errors are typed with the reasons
 	ret, _, err := h.proxy.DoRequest(req, op, proxyrequest)
 	if err != nil {
 		response.HandleError(resp, err)
@@ -94,7 +170,13 @@ func (h *Handler) handleProxy(op string, req *restful.Request, resp *restful.Res
 	switch op {
 	case sysv1alpha1.Create, sysv1alpha1.Update, sysv1alpha1.Delete:
 		dispatchRequest := serviceproxy.NewDispatchRequest(proxyrequest, ret)
-		h.dispatcher.DoWatch(dispatchRequest)
+		h.dispatcher.DoWatch(req.Request.Context(), dispatchRequest)
+
+	case sysv1alpha1.List:
+		if page := serviceproxy.NewListPage(ret); page != nil {
+			response.SuccessWithPage(resp, ret, page)
+			return
+		}
 	}
 
 	response.Success(resp, ret)
@@ -0,0 +1,133 @@
+package legacy
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	sysv1alpha1 "bytetrade.io/web3os/system-server/pkg/apis/sys/v1alpha1"
+	"bytetrade.io/web3os/system-server/pkg/metrics"
+	permission "bytetrade.io/web3os/system-server/pkg/permission/v1alpha1"
+	prodiverregistry "bytetrade.io/web3os/system-server/pkg/providerregistry/v1alpha1"
+	serviceproxy "bytetrade.io/web3os/system-server/pkg/serviceproxy/v1alpha1"
+	"bytetrade.io/web3os/system-server/pkg/tracing"
+	"bytetrade.io/web3os/system-server/pkg/utils"
+
+	otelcodes "go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"k8s.io/klog/v2"
+)
+
+// grpcRoute is the route of the grpc calls in the metrics, the methods are not
+// bounded before the calls are authorized.
+const grpcRoute = "grpc"
+
+// GRPCHandler proxies the grpc calls to the providers of legacy_api, the other
+// requests are served by next.
+type GRPCHandler struct {
+	proxy *serviceproxy.Proxy
+	next  http.Handler
+}
+
+// NewGRPCHandler constructs a GRPCHandler, the server must accept HTTP/2, e.g. with
+// h2c for the cleartext connections.
+func NewGRPCHandler(registry *prodiverregistry.Registry, next http.Handler) *GRPCHandler {
+	return &GRPCHandler{
+		proxy: serviceproxy.NewProxy(registry),
+		next:  next,
+	}
+}
+
+func (h *GRPCHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !serviceproxy.IsGRPCRequest(r) {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+
+	// the grpc calls bypass the filters of the container, they're traced, counted
+	// and logged here the same way
+	start := time.Now()
+	ctx := tracing.Extract(r.Context(), r.Header)
+	ctx, span := tracing.Start(ctx, strings.TrimPrefix(r.URL.Path, "/"),
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			semconv.RPCSystemGRPC,
+			semconv.URLPath(r.URL.Path),
+		))
+	defer span.End()
+
+	h.serveGRPC(w, r.WithContext(ctx))
+
+	code := serviceproxy.GRPCStatus(w.Header())
+	span.SetAttributes(semconv.RPCGRPCStatusCodeKey.Int(int(code)))
+	if isServerError(code) {
+		span.SetStatus(otelcodes.Error, code.String())
+	}
+
+	metrics.HTTPRequests.WithLabelValues(grpcRoute, metrics.Method(r.Method), code.String()).Inc()
+	metrics.HTTPRequestDuration.WithLabelValues(grpcRoute, metrics.Method(r.Method)).Observe(time.Since(start).Seconds())
+
+	logWithVerbose := klog.V(4)
+	if code != codes.OK {
+		logWithVerbose = klog.V(0)
+	}
+	logWithVerbose.Infof("%s - \"%s %s %s\" grpc %s %dms",
+		utils.RemoteIP(r), r.Method, r.URL.Path, r.Proto, code, time.Since(start)/time.Millisecond)
+}
+
+// isServerError returns whether the grpc call failed on the server side, as the
+// 5xx of http.
+func isServerError(code codes.Code) bool {
+	switch code {
+	case codes.Unknown, codes.DeadlineExceeded, codes.Unimplemented, codes.Internal,
+		codes.Unavailable, codes.DataLoss:
+		return true
+	}
+
+	return false
+}
+
+func (h *GRPCHandler) serveGRPC(w http.ResponseWriter, r *http.Request) {
+	group, version, method, err := serviceproxy.GRPCMethod(r)
+	if err != nil {
+		serviceproxy.WriteGRPCError(w, codes.InvalidArgument, err.Error())
+		return
+	}
+
+	klog.Info("proxy grpc ", method, " of ", group, "/", version)
+
+	// the same authorization as the legacy v2 api, the method path is the op uri
+	appKey := r.Header.Get("X-App-Key")
+	if appKey == "" {
+		serviceproxy.WriteGRPCError(w, codes.Unauthenticated, "empty X-App-Key")
+		return
+	}
+
+	signature := r.Header.Get("X-Auth-Signature")
+	if signature == "" {
+		serviceproxy.WriteGRPCError(w, codes.Unauthenticated, "invalid signature")
+		return
+	}
+
+	err = permission.ValidateAppKey(appKey, method, sysv1alpha1.LegacyAPI, version, group, signature)
+	if err != nil {
+		if errors.Is(err, prodiverregistry.ErrProviderNotFound) {
+			serviceproxy.WriteGRPCError(w, codes.Unimplemented, err.Error())
+			return
+		}
+		serviceproxy.WriteGRPCError(w, codes.PermissionDenied, "permission denied: err="+err.Error())
+		return
+	}
+
+	err = h.proxy.ProxyGRPC(r.Context(), group, version, method, w, r)
+	if err != nil {
+		if errors.Is(err, prodiverregistry.ErrProviderNotFound) {
+			serviceproxy.WriteGRPCError(w, codes.Unimplemented, err.Error())
+			return
+		}
+		serviceproxy.WriteGRPCError(w, codes.Internal, err.Error())
+	}
+}
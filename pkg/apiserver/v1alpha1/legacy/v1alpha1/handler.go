@@ -5,7 +5,6 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"net/http"
 	"net/http/httputil"
 	"reflect"
@@ -39,6 +38,14 @@ func (h *Handler) do(req *restful.Request, resp *restful.Response) {
 	klog.Info("proxy ", h.method, " /", req.PathParameter(serviceproxy.ParamSubPath))
 
 	proxyRespIntf, err := h.proxy.ProxyLegacyAPI(req.Request.Context(), h.method, req, resp)
+	if errors.Is(err, serviceproxy.ErrRequestBodyTooLarge) {
+		api.HandleRequestEntityTooLarge(resp, req, err)
+		return
+	}
+	if errors.Is(err, prodiverregistry.ErrProviderNotFound) {
+		api.HandleNotFound(resp, req, err)
+		return
+	}
 	if err != nil && isNil(proxyRespIntf) {
 		klog.Info("proxy error: ", err)
 		api.HandleError(resp, req, err)
@@ -52,7 +59,7 @@ func (h *Handler) do(req *restful.Request, resp *restful.Response) {
 
 	switch proxyResp := proxyRespIntf.(type) {
 	case *resty.Response:
-		dump, e := httputil.DumpRequest(proxyResp.Request.RawRequest, true)
+		dump, e := httputil.DumpRequest(proxyResp.Request.RawRequest, false)
 		if e != nil {
 			klog.Error("dump request err: ", e)
 		} else {
@@ -81,8 +88,12 @@ func (h *Handler) do(req *restful.Request, resp *restful.Response) {
 			http.SetCookie(resp, c)
 		}
 
+		// the response is streamed, e.g. the partial content of range requests
+		defer proxyResp.RawBody().Close()
 		resp.WriteHeader(proxyResp.StatusCode())
-		resp.Write(proxyResp.Body())
+		if _, err = io.Copy(resp, proxyResp.RawBody()); err != nil {
+			klog.Info("copy proxy response error: ", err)
+		}
 
 	case *serviceproxy.WsProxyResponse:
 		if proxyResp.RawResponse == nil {
@@ -123,7 +134,11 @@ func (h *Handler) doV2(req *restful.Request, resp *restful.Response) {
 		return
 	}
 
-	proxyRespIntf, err := h.proxy.ProxyLegacyAPIV2(req.Request.Context(), h.method, req, resp)
+	proxyRespIntf, err := h.proxy.ProxyLegacyAPIV2(req.Request.Context(), h.method, appKey, req, resp)
+	if errors.Is(err, serviceproxy.ErrRequestBodyTooLarge) {
+		api.HandleRequestEntityTooLarge(resp, req, err)
+		return
+	}
 	if err != nil && errors.Is(err, prodiverregistry.ErrProviderNotFound) {
 		api.HandleNotFound(resp, req, err)
 		return
@@ -140,7 +155,7 @@ func (h *Handler) doV2(req *restful.Request, resp *restful.Response) {
 	}
 	switch proxyResp := proxyRespIntf.(type) {
 	case *resty.Response:
-		dump, e := httputil.DumpRequest(proxyResp.Request.RawRequest, true)
+		dump, e := httputil.DumpRequest(proxyResp.Request.RawRequest, false)
 		if e != nil {
 			klog.Error("dump request err: ", e)
 		} else {
@@ -169,17 +184,47 @@ func (h *Handler) doV2(req *restful.Request, resp *restful.Response) {
 		if proxyResp.RawBody() != nil {
 			defer proxyResp.RawBody().Close()
 		}
+		encoding := serviceproxy.NegotiateResponseEncoding(h.method,
+			req.Request.Header.Get("Accept-Encoding"), proxyResp.RawResponse)
+
+		// the headers are fixed once the body can be decoded, the error is not
+		// in the encoding of provider
+		body, err := encoding.Reader(proxyResp.RawBody())
+		if err != nil {
+			klog.Info("decode proxy response error: ", err)
+			resp.Header().Del("Content-Encoding")
+			resp.Header().Del("Content-Length")
+			api.HandleError(resp, req, err)
+			return
+		}
+		defer body.Close()
+		encoding.SetHeader(resp.Header())
+
 		if isSSEOrNdJson(resp.Header()) {
 			resp.WriteHeader(proxyResp.StatusCode())
-			err = handleSSEOrNdJsonPROXY(resp, proxyResp.RawBody())
+			err = handleSSEOrNdJsonPROXY(resp, body)
 			if err != nil {
 				klog.Infof("handleSSEOrNdJsonPROXY err=%v", err)
 			}
 		} else {
-			resp.Header().Del("Content-Length")
+			// the length of partial content and head responses is kept for the
+			// range requests, the body is copied as is
+			if proxyResp.StatusCode() != http.StatusPartialContent && h.method != http.MethodHead {
+				resp.Header().Del("Content-Length")
+			}
 			resp.WriteHeader(proxyResp.StatusCode())
-			content, _ := ioutil.ReadAll(proxyResp.RawBody())
-			resp.Write(content)
+
+			w, err := encoding.Writer(resp)
+			if err != nil {
+				klog.Info("encode proxy response error: ", err)
+				return
+			}
+			if _, err = io.Copy(w, body); err != nil {
+				klog.Info("copy proxy response error: ", err)
+			}
+			if err = w.Close(); err != nil {
+				klog.Info("encode proxy response error: ", err)
+			}
 		}
 
 	case *serviceproxy.WsProxyResponse:
@@ -0,0 +1,314 @@
+package apiserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	sysv1alpha1 "bytetrade.io/web3os/system-server/pkg/apis/sys/v1alpha1"
+	"bytetrade.io/web3os/system-server/pkg/apiserver/v1alpha1/api"
+	permission "bytetrade.io/web3os/system-server/pkg/permission/v1alpha1"
+	prodiverregistry "bytetrade.io/web3os/system-server/pkg/providerregistry/v1alpha1"
+
+	restfulspec "github.com/emicklei/go-restful-openapi/v2"
+	"github.com/emicklei/go-restful/v3"
+	"github.com/getkin/kin-openapi/openapi2"
+	"github.com/getkin/kin-openapi/openapi2conv"
+	"github.com/go-openapi/spec"
+	swaggerFiles "github.com/swaggo/files/v2"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/klog/v2"
+)
+
+const (
+	APIDocsPath   = "/system-server/v1alpha1/apidocs.json"
+	APIDocsV3Path = "/system-server/v1alpha1/apidocs.v3.json"
+	SwaggerUIPath = "/system-server/v1alpha1/swagger-ui"
+
+	swaggerInitializer = "swagger-initializer.js"
+	dataAPIPrefix      = "/system-server/v1alpha1"
+)
+
+var (
+	OPENAPI_TAGS = []string{"openapi"}
+)
+
+// openAPI serves the OpenAPI spec aggregated from the web services of the container,
+// merged with the paths of the data types declaring JSON Schemas in their providers.
+// The spec is public, the provider paths are merged only for the ops the access
+// token of the caller is granted, as the discovery does.
+type openAPI struct {
+	container *restful.Container
+	registry  *prodiverregistry.Registry
+	ctrlSet   *permission.PermissionControlSet
+
+	once sync.Once
+	base []byte // the spec of web services, built once all of them are added
+}
+
+func addOpenAPIToContainer(c *restful.Container, registry *prodiverregistry.Registry, ctrlSet *permission.PermissionControlSet) error {
+	o := &openAPI{container: c, registry: registry, ctrlSet: ctrlSet}
+
+	ws := new(restful.WebService)
+	ws.Path(APIDocsPath).Produces(restful.MIME_JSON)
+	ws.Route(ws.GET("").
+		To(o.specV2).
+		Doc("Get the OpenAPI v2 spec of system-server").
+		Metadata(restfulspec.KeyOpenAPITags, OPENAPI_TAGS).
+		Param(ws.HeaderParameter(api.AccessTokenHeader, "Access token, the data types it's granted are included")).
+		Returns(http.StatusOK, "Success to get the OpenAPI v2 spec", nil))
+	c.Add(ws)
+
+	v3ws := new(restful.WebService)
+	v3ws.Path(APIDocsV3Path).Produces(restful.MIME_JSON)
+	v3ws.Route(v3ws.GET("").
+		To(o.specV3).
+		Doc("Get the OpenAPI v3 spec of system-server").
+		Metadata(restfulspec.KeyOpenAPITags, OPENAPI_TAGS).
+		Param(v3ws.HeaderParameter(api.AccessTokenHeader, "Access token, the data types it's granted are included")).
+		Returns(http.StatusOK, "Success to get the OpenAPI v3 spec", nil))
+	c.Add(v3ws)
+
+	uiws := new(restful.WebService)
+	uiws.Path(SwaggerUIPath)
+	for _, path := range []string{"", "/", "/{subpath:*}"} {
+		uiws.Route(uiws.GET(path).
+			To(swaggerUI).
+			Doc("Swagger UI of system-server").
+			Metadata(restfulspec.KeyOpenAPITags, OPENAPI_TAGS))
+	}
+	c.Add(uiws)
+
+	return nil
+}
+
+func (o *openAPI) specV2(req *restful.Request, resp *restful.Response) {
+	swagger, err := o.build(req.Request.Context(), req.Request.Header.Get(api.AccessTokenHeader))
+	if err != nil {
+		api.HandleError(resp, req, err)
+		return
+	}
+
+	resp.WriteAsJson(swagger)
+}
+
+func (o *openAPI) specV3(req *restful.Request, resp *restful.Response) {
+	swagger, err := o.build(req.Request.Context(), req.Request.Header.Get(api.AccessTokenHeader))
+	if err != nil {
+		api.HandleError(resp, req, err)
+		return
+	}
+
+	// convert through json, the v2 models of go-openapi and kin-openapi are the same spec
+	data, err := json.Marshal(swagger)
+	if err != nil {
+		api.HandleError(resp, req, err)
+		return
+	}
+
+	var doc2 openapi2.T
+	if err = json.Unmarshal(data, &doc2); err != nil {
+		api.HandleError(resp, req, err)
+		return
+	}
+
+	doc3, err := openapi2conv.ToV3(&doc2)
+	if err != nil {
+		api.HandleError(resp, req, err)
+		return
+	}
+
+	resp.WriteAsJson(doc3)
+}
+
+// build returns a copy of the base spec merged with the specs of the providers
+// the token is granted.
+func (o *openAPI) build(ctx context.Context, token string) (*spec.Swagger, error) {
+	o.once.Do(func() {
+		swagger := restfulspec.BuildSwagger(restfulspec.Config{
+			WebServices:                   o.container.RegisteredWebServices(),
+			APIPath:                       APIDocsPath,
+			PostBuildSwaggerObjectHandler: enrichSwaggerObject,
+		})
+
+		var err error
+		if o.base, err = json.Marshal(swagger); err != nil {
+			klog.Error("marshal openapi spec error, ", err)
+		}
+	})
+
+	var swagger spec.Swagger
+	if err := json.Unmarshal(o.base, &swagger); err != nil {
+		return nil, err
+	}
+
+	// the provider schemas are never public
+	if o.registry == nil || o.ctrlSet == nil || token == "" {
+		return &swagger, nil
+	}
+
+	providers, err := o.registry.ListProviders(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, provider := range providers {
+		mergeProviderSpec(&swagger, provider, func(op string) bool {
+			return permission.AccessTokenAllows(token, op,
+				provider.Spec.DataType, provider.Spec.Version, provider.Spec.Group, o.ctrlSet)
+		})
+	}
+
+	return &swagger, nil
+}
+
+func enrichSwaggerObject(swagger *spec.Swagger) {
+	swagger.Info = &spec.Info{
+		InfoProps: spec.InfoProps{
+			Title:       "system-server",
+			Description: "The permission, provider registry and data apis of system-server",
+			Version:     "v1alpha1",
+		},
+	}
+}
+
+// mergeProviderSpec adds the concrete paths of the ops declaring inline schemas, so
+// that the clients get the data models of the data type. The schemas in ConfigMaps
+// are not merged, they are loaded on demand by the validator. Only the ops allowed
+// are merged.
+func mergeProviderSpec(swagger *spec.Swagger, provider *sysv1alpha1.ProviderRegistry, allowed func(op string) bool) {
+	if swagger.Paths == nil {
+		swagger.Paths = &spec.Paths{Paths: map[string]spec.PathItem{}}
+	}
+	if swagger.Definitions == nil {
+		swagger.Definitions = spec.Definitions{}
+	}
+
+	tag := strings.Join([]string{provider.Spec.DataType, provider.Spec.Group, provider.Spec.Version}, "/")
+	base := fmt.Sprintf("%s/%s/%s/%s", dataAPIPrefix, provider.Spec.DataType, provider.Spec.Group, provider.Spec.Version)
+	prefix := strings.Join([]string{provider.Spec.Group, provider.Spec.DataType, provider.Spec.Version}, ".")
+
+	for _, op := range provider.Spec.OpApis {
+		if !allowed(op.Name) {
+			continue
+		}
+
+		requestSchema := providerSchema(provider, op.RequestSchema)
+		responseSchema := providerSchema(provider, op.ResponseSchema)
+		if requestSchema == nil && responseSchema == nil {
+			continue
+		}
+
+		method, path := opRoute(base, op.Name)
+		operation := spec.NewOperation(fmt.Sprintf("%s.%s", prefix, op.Name)).
+			WithSummary(fmt.Sprintf("%s %s of provider %s", op.Name, tag, provider.Name)).
+			WithTags(tag).
+			WithProduces(restful.MIME_JSON).
+			AddParam(spec.HeaderParam(api.AccessTokenHeader).Typed("string", "").AsRequired())
+
+		if strings.Contains(path, "{"+api.ParamDataID+"}") {
+			operation.AddParam(spec.PathParam(api.ParamDataID).Typed("string", ""))
+		}
+
+		if requestSchema != nil && method != http.MethodGet {
+			name := prefix + "." + op.Name + "Request"
+			swagger.Definitions[name] = *requestSchema
+			operation.WithConsumes(restful.MIME_JSON).
+				AddParam(spec.BodyParam("body", spec.RefSchema("#/definitions/"+name)).AsRequired())
+		}
+
+		response := spec.NewResponse().WithDescription("success")
+		if responseSchema != nil {
+			name := prefix + "." + op.Name + "Response"
+			swagger.Definitions[name] = *responseSchema
+			response.WithSchema(spec.RefSchema("#/definitions/" + name))
+		}
+		operation.RespondsWith(http.StatusOK, response)
+
+		item := swagger.Paths.Paths[path]
+		switch method {
+		case http.MethodGet:
+			item.Get = operation
+		case http.MethodPut:
+			item.Put = operation
+		case http.MethodDelete:
+			item.Delete = operation
+		default:
+			item.Post = operation
+		}
+		swagger.Paths.Paths[path] = item
+	}
+}
+
+// opRoute returns the method and path of op in the data api.
+func opRoute(base, op string) (string, string) {
+	switch op {
+	case sysv1alpha1.Get:
+		return http.MethodGet, base + "/{" + api.ParamDataID + "}"
+	case sysv1alpha1.List:
+		return http.MethodGet, base
+	case sysv1alpha1.Create:
+		return http.MethodPost, base
+	case sysv1alpha1.Update:
+		return http.MethodPut, base + "/{" + api.ParamDataID + "}"
+	case sysv1alpha1.Delete:
+		return http.MethodDelete, base + "/{" + api.ParamDataID + "}"
+	default:
+		return http.MethodPost, base + "/" + op
+	}
+}
+
+func providerSchema(provider *sysv1alpha1.ProviderRegistry, raw *runtime.RawExtension) *spec.Schema {
+	if raw == nil || len(raw.Raw) == 0 {
+		return nil
+	}
+
+	var schema spec.Schema
+	if err := json.Unmarshal(raw.Raw, &schema); err != nil {
+		klog.Warning("invalid schema of provider ", provider.Name, ", ", err)
+		return nil
+	}
+
+	return &schema
+}
+
+// swaggerUI serves the embedded Swagger UI, with the initializer loading our specs.
+func swaggerUI(req *restful.Request, resp *restful.Response) {
+	if req.Request.URL.Path == SwaggerUIPath {
+		http.Redirect(resp.ResponseWriter, req.Request, SwaggerUIPath+"/", http.StatusMovedPermanently)
+		return
+	}
+
+	if req.PathParameter("subpath") == swaggerInitializer {
+		resp.Header().Set(restful.HEADER_ContentType, "application/javascript")
+		fmt.Fprintf(resp, swaggerInitializerScript, APIDocsPath, APIDocsV3Path)
+		return
+	}
+
+	swaggerFileServer.ServeHTTP(resp.ResponseWriter, req.Request)
+}
+
+var swaggerFileServer = http.StripPrefix(SwaggerUIPath, http.FileServerFS(swaggerFiles.FS))
+
+const swaggerInitializerScript = `window.onload = function() {
+  window.ui = SwaggerUIBundle({
+    urls: [
+      {url: "%s", name: "OpenAPI v2"},
+      {url: "%s", name: "OpenAPI v3"}
+    ],
+    dom_id: '#swagger-ui',
+    deepLinking: true,
+    presets: [
+      SwaggerUIBundle.presets.apis,
+      SwaggerUIStandalonePreset
+    ],
+    plugins: [
+      SwaggerUIBundle.plugins.DownloadUrl
+    ],
+    layout: "StandaloneLayout"
+  });
+};
+`
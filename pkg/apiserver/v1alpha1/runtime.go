@@ -12,3 +12,21 @@ func newWebService() *restful.WebService {
 
 	return &webservice
 }
+
+func newDeadLetterWebService() *restful.WebService {
+	webservice := restful.WebService{}
+
+	webservice.Path("/system-server/v1alpha1/deadletters").
+		Produces(restful.MIME_JSON)
+
+	return &webservice
+}
+
+func newWebhookWebService() *restful.WebService {
+	webservice := restful.WebService{}
+
+	webservice.Path("/system-server/v1alpha1/webhook").
+		Produces(restful.MIME_JSON)
+
+	return &webservice
+}
@@ -0,0 +1,463 @@
+package apiserver
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	sysv1alpha1 "bytetrade.io/web3os/system-server/pkg/apis/sys/v1alpha1"
+	"bytetrade.io/web3os/system-server/pkg/apiserver/v1alpha1/api"
+	"bytetrade.io/web3os/system-server/pkg/apiserver/v1alpha1/api/response"
+	"bytetrade.io/web3os/system-server/pkg/metrics"
+	permission "bytetrade.io/web3os/system-server/pkg/permission/v1alpha1"
+	serviceproxy "bytetrade.io/web3os/system-server/pkg/serviceproxy/v1alpha1"
+	"bytetrade.io/web3os/system-server/pkg/tracing"
+
+	"github.com/emicklei/go-restful/v3"
+	"github.com/gorilla/websocket"
+	"github.com/jellydator/ttlcache/v3"
+	"k8s.io/klog/v2"
+)
+
+const (
+	ParamOp         = "op"
+	ParamFilter     = "filter"
+	ParamExpression = "expression"
+	ParamFormat     = "format"
+
+	// ParamTicket carries the watch ticket of the stream, since the browsers can't
+	// set headers on EventSource and WebSocket.
+	ParamTicket = "ticket"
+
+	// WatchTicketTTL is how long a watch ticket can be used, it can be used once.
+	WatchTicketTTL      = 30 * time.Second
+	watchTicketCapacity = 1000
+
+	// WatchHeartbeatPeriod keeps the idle streams alive through the proxies.
+	WatchHeartbeatPeriod = 30 * time.Second
+
+	watchWriteTimeout = 10 * time.Second
+	watchPath         = "/watch"
+
+	// eventsPrefix is the reserved first segment of the event routes, so they never
+	// shadow the data ids, e.g. /_events/<datatype>/<group>/<version>/watch. The
+	// data types starting with "_" are reserved.
+	eventsPrefix = "/_events"
+)
+
+var watchUpgrader = &websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+	// the stream is authorized by the access token, not cookies
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// WatchTicket opens a watch stream once in place of the access token, so the
+// token is never sent in the url.
+type WatchTicket struct {
+	Ticket string `json:"ticket"`
+	// ExpiresIn is the seconds the ticket is valid for.
+	ExpiresIn int `json:"expiresIn"`
+}
+
+// watchTicket is the access token a ticket is issued for, to watch the data type.
+type watchTicket struct {
+	token    string
+	dataType string
+	group    string
+	version  string
+}
+
+func newWatchTickets() *ttlcache.Cache[string, *watchTicket] {
+	return ttlcache.New(
+		ttlcache.WithTTL[string, *watchTicket](WatchTicketTTL),
+		ttlcache.WithCapacity[string, *watchTicket](watchTicketCapacity),
+	)
+}
+
+// watchEvent is an event sent through the WebSocket stream.
+type watchEvent struct {
+	Type  string                        `json:"type"`
+	Event *serviceproxy.DispatchRequest `json:"event,omitempty"`
+	Error string                        `json:"error,omitempty"`
+}
+
+// eventWriter writes the events to a watch stream.
+type eventWriter interface {
+	write(event *serviceproxy.DispatchRequest) error
+	heartbeat() error
+	close(err error)
+	// done is closed when the client has gone
+	done() <-chan struct{}
+}
+
+// watch streams the data change events to the caller with the permission of Watch
+// op, through WebSocket if it's an upgrade request, or Server-Sent Events otherwise.
+//
+// The events are filtered by the query parameters: op (repeatable), filter
+// (repeatable, "<dotted path>=<value>") and expression (CEL on `event`). The stream
+// resumes after the cursor parameter or the Last-Event-ID header from the event log.
+func (h *Handler) watch(req *restful.Request, resp *restful.Response) {
+	token := h.watchAccessToken(req)
+	appKey, err := permission.ValidateAccessTokenWithRequest(token, sysv1alpha1.Watch, req, h.permissionCtrl)
+	if err != nil {
+		response.HandleForbidden(resp, err)
+		return
+	}
+
+	cursor, err := watchCursor(req)
+	if err != nil {
+		response.HandleBadRequest(resp, err)
+		return
+	}
+
+	filter := sysv1alpha1.Callback{
+		Expression: req.QueryParameter(ParamExpression),
+	}
+	for _, f := range req.QueryParameters(ParamFilter) {
+		path, value, ok := strings.Cut(f, "=")
+		if !ok || path == "" {
+			response.HandleBadRequest(resp, fmt.Errorf("invalid filter %q, want <path>=<value>", f))
+			return
+		}
+
+		filter.Rules = append(filter.Rules, sysv1alpha1.FilterRule{
+			Path:     path,
+			Operator: sysv1alpha1.FilterIn,
+			Values:   []string{value},
+		})
+	}
+
+	format := req.QueryParameter(ParamFormat)
+	if format != "" && format != sysv1alpha1.FormatLegacy && format != sysv1alpha1.FormatCloudEvents {
+		response.HandleBadRequest(resp, fmt.Errorf("unsupported stream format %q", format))
+		return
+	}
+
+	sub, err := serviceproxy.NewSubscription(
+		req.PathParameter(api.ParamDataType),
+		req.PathParameter(api.ParamGroup),
+		req.PathParameter(api.ParamVersion),
+		appKey,
+		req.QueryParameters(ParamOp),
+		filter,
+	)
+	if err != nil {
+		response.HandleBadRequest(resp, err)
+		return
+	}
+
+	var w eventWriter
+	if websocket.IsWebSocketUpgrade(req.Request) {
+		_, span := tracing.Start(req.Request.Context(), "websocket setup")
+		conn, err := watchUpgrader.Upgrade(resp.ResponseWriter, req.Request, nil)
+		tracing.End(span, err)
+		if err != nil {
+			// the upgrader has replied the error
+			klog.Error("upgrade watch stream error, ", err)
+			return
+		}
+
+		w = newWSEventWriter(conn, format)
+		metrics.WebsocketConnections.WithLabelValues("watch").Inc()
+		defer metrics.WebsocketConnections.WithLabelValues("watch").Dec()
+	} else {
+		flusher, ok := resp.ResponseWriter.(http.Flusher)
+		if !ok {
+			response.HandleError(resp, errors.New("streaming is not supported"))
+			return
+		}
+
+		w = newSSEEventWriter(req.Request.Context(), resp.ResponseWriter, flusher, format)
+		metrics.SSEStreams.Inc()
+		defer metrics.SSEStreams.Dec()
+	}
+
+	// subscribe before the replay, so that no event is missed in between
+	h.dispatcher.Subscribe(sub)
+	defer h.dispatcher.Unsubscribe(sub)
+
+	klog.Info("watch stream started, app: ", appKey, ", cursor: ", cursor)
+	err = h.streamEvents(sub, w, cursor, token)
+	w.close(err)
+	klog.Info("watch stream closed, app: ", appKey, ", ", err)
+}
+
+// streamEvents writes the events to the stream until the client has gone, or the
+// access token of the stream has expired.
+func (h *Handler) streamEvents(sub *serviceproxy.Subscription, w eventWriter, cursor int64, token string) error {
+	if cursor > 0 {
+		last, err := h.replay(sub, w, cursor)
+		if err != nil {
+			return err
+		}
+		cursor = last
+	}
+
+	ticker := time.NewTicker(WatchHeartbeatPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done():
+			return nil
+
+		case <-ticker.C:
+			if !permission.AccessTokenAlive(token, h.permissionCtrl) {
+				return errors.New("access token expired")
+			}
+
+			if err := w.heartbeat(); err != nil {
+				return err
+			}
+
+		case event, ok := <-sub.Events():
+			if !ok {
+				return sub.Err()
+			}
+
+			// already sent by the replay
+			if event.Cursor != 0 && event.Cursor <= cursor {
+				continue
+			}
+
+			if err := w.write(event); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// replay sends the events recorded after the cursor, returns the cursor of the last one.
+func (h *Handler) replay(sub *serviceproxy.Subscription, w eventWriter, cursor int64) (int64, error) {
+	for {
+		list, err := h.dispatcher.Events(sub.DataType, sub.Group, sub.Version, cursor, 0)
+		if err != nil {
+			return cursor, err
+		}
+
+		if list.Truncated {
+			return cursor, fmt.Errorf("events after cursor %d have been dropped, backfill with cursor 0", cursor)
+		}
+
+		for _, e := range list.Events {
+			event, err := e.DispatchRequest()
+			if err != nil {
+				klog.Error("decode event ", e.Cursor, " error, ", err)
+				continue
+			}
+
+			if !sub.Match(event) {
+				continue
+			}
+
+			if err = w.write(event); err != nil {
+				return cursor, err
+			}
+		}
+
+		cursor = list.Cursor
+		if !list.More {
+			return cursor, nil
+		}
+	}
+}
+
+// watchTicket issues a ticket to open a watch stream of the data type with the
+// access token.
+func (h *Handler) watchTicket(req *restful.Request, resp *restful.Response) {
+	token := req.Request.Header.Get(api.AccessTokenHeader)
+	_, err := permission.ValidateAccessTokenWithRequest(token, sysv1alpha1.Watch, req, h.permissionCtrl)
+	if err != nil {
+		response.HandleForbidden(resp, err)
+		return
+	}
+
+	b := make([]byte, 32)
+	if _, err = rand.Read(b); err != nil {
+		response.HandleError(resp, err)
+		return
+	}
+
+	ticket := base64.RawURLEncoding.EncodeToString(b)
+	h.watchTickets.Set(ticket, &watchTicket{
+		token:    token,
+		dataType: req.PathParameter(api.ParamDataType),
+		group:    req.PathParameter(api.ParamGroup),
+		version:  req.PathParameter(api.ParamVersion),
+	}, ttlcache.DefaultTTL)
+
+	response.Success(resp, &WatchTicket{Ticket: ticket, ExpiresIn: int(WatchTicketTTL.Seconds())})
+}
+
+// watchAccessToken returns the access token in header, or the one the ticket is
+// issued for, the ticket is used up.
+func (h *Handler) watchAccessToken(req *restful.Request) string {
+	if token := req.Request.Header.Get(api.AccessTokenHeader); token != "" {
+		return token
+	}
+
+	ticket := req.QueryParameter(ParamTicket)
+	if ticket == "" {
+		return ""
+	}
+
+	item, ok := h.watchTickets.GetAndDelete(ticket)
+	if !ok {
+		return ""
+	}
+
+	t := item.Value()
+	if t.dataType != req.PathParameter(api.ParamDataType) ||
+		t.group != req.PathParameter(api.ParamGroup) ||
+		t.version != req.PathParameter(api.ParamVersion) {
+		return ""
+	}
+
+	return t.token
+}
+
+func watchCursor(req *restful.Request) (int64, error) {
+	c := req.QueryParameter(ParamCursor)
+	if c == "" {
+		// the EventSource reconnects with the id of the last event
+		c = req.Request.Header.Get("Last-Event-ID")
+	}
+
+	if c == "" {
+		return 0, nil
+	}
+
+	cursor, err := strconv.ParseInt(c, 10, 64)
+	if err != nil || cursor < 0 {
+		return 0, errors.New("invalid cursor")
+	}
+
+	return cursor, nil
+}
+
+type sseEventWriter struct {
+	ctx     context.Context
+	w       http.ResponseWriter
+	flusher http.Flusher
+	format  string
+}
+
+func newSSEEventWriter(ctx context.Context, w http.ResponseWriter, flusher http.Flusher, format string) *sseEventWriter {
+	w.Header().Set(restful.HEADER_ContentType, "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// tell nginx not to buffer the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	return &sseEventWriter{ctx: ctx, w: w, flusher: flusher, format: format}
+}
+
+func (s *sseEventWriter) done() <-chan struct{} {
+	return s.ctx.Done()
+}
+
+func (s *sseEventWriter) write(event *serviceproxy.DispatchRequest) error {
+	_, data, err := serviceproxy.EncodeEvent(event, s.format)
+	if err != nil {
+		return err
+	}
+
+	if event.Cursor != 0 {
+		if _, err = fmt.Fprintf(s.w, "id: %d\n", event.Cursor); err != nil {
+			return err
+		}
+	}
+
+	if _, err = fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event.Op, data); err != nil {
+		return err
+	}
+
+	s.flusher.Flush()
+	return nil
+}
+
+func (s *sseEventWriter) heartbeat() error {
+	if _, err := fmt.Fprint(s.w, ": heartbeat\n\n"); err != nil {
+		return err
+	}
+
+	s.flusher.Flush()
+	return nil
+}
+
+func (s *sseEventWriter) close(err error) {
+	if err == nil {
+		return
+	}
+
+	data, _ := json.Marshal(err.Error())
+	fmt.Fprintf(s.w, "event: error\ndata: %s\n\n", data)
+	s.flusher.Flush()
+}
+
+type wsEventWriter struct {
+	conn   *websocket.Conn
+	format string
+	closed chan struct{}
+}
+
+func newWSEventWriter(conn *websocket.Conn, format string) *wsEventWriter {
+	s := &wsEventWriter{conn: conn, format: format, closed: make(chan struct{})}
+
+	// drain the control frames, the stream is write only
+	go func() {
+		defer close(s.closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	return s
+}
+
+func (s *wsEventWriter) done() <-chan struct{} {
+	return s.closed
+}
+
+func (s *wsEventWriter) write(event *serviceproxy.DispatchRequest) error {
+	s.conn.SetWriteDeadline(time.Now().Add(watchWriteTimeout))
+	if serviceproxy.IsCloudEvents(s.format) {
+		// a CloudEvent in structured mode per message
+		_, data, err := serviceproxy.EncodeEvent(event, s.format)
+		if err != nil {
+			return err
+		}
+
+		return s.conn.WriteMessage(websocket.TextMessage, data)
+	}
+
+	return s.conn.WriteJSON(watchEvent{Type: event.Op, Event: event})
+}
+
+func (s *wsEventWriter) heartbeat() error {
+	return s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(watchWriteTimeout))
+}
+
+func (s *wsEventWriter) close(err error) {
+	msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	if err != nil {
+		s.conn.SetWriteDeadline(time.Now().Add(watchWriteTimeout))
+		s.conn.WriteJSON(watchEvent{Type: "error", Error: err.Error()})
+		msg = websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "")
+	}
+
+	s.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(watchWriteTimeout))
+	s.conn.Close()
+}
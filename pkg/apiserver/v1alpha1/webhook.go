@@ -0,0 +1,37 @@
+package apiserver
+
+import (
+	"errors"
+
+	"bytetrade.io/web3os/system-server/pkg/apiserver/v1alpha1/api"
+	"bytetrade.io/web3os/system-server/pkg/apiserver/v1alpha1/api/response"
+	"bytetrade.io/web3os/system-server/pkg/webhook"
+
+	"github.com/emicklei/go-restful/v3"
+)
+
+// PublicKeyResponse is the public key to verify the watcher callbacks
+// signed by system-server.
+type PublicKeyResponse struct {
+	Algorithm string `json:"algorithm"`
+	PublicKey string `json:"publicKey"`
+}
+
+func (h *Handler) publicKey(req *restful.Request, resp *restful.Response) {
+	key := h.dispatcher.PublicKey()
+	if key == nil {
+		api.HandleNotFound(resp, req, errors.New("no signing key"))
+		return
+	}
+
+	pem, err := webhook.EncodePublicKey(key)
+	if err != nil {
+		api.HandleError(resp, req, err)
+		return
+	}
+
+	response.Success(resp, PublicKeyResponse{
+		Algorithm: webhook.SchemeEd25519,
+		PublicKey: pem,
+	})
+}
@@ -7,6 +7,7 @@ import (
 	"bytetrade.io/web3os/system-server/pkg/apiserver/v1alpha1/api"
 	permission "bytetrade.io/web3os/system-server/pkg/permission/v1alpha1"
 	prodiverregistry "bytetrade.io/web3os/system-server/pkg/providerregistry/v1alpha1"
+	serviceproxy "bytetrade.io/web3os/system-server/pkg/serviceproxy/v1alpha1"
 
 	restfulspec "github.com/emicklei/go-restful-openapi/v2"
 	"github.com/emicklei/go-restful/v3"
@@ -17,12 +18,16 @@ var (
 	MODULE_TAGS = []string{"service-proxy"}
 )
 
-func addServiceToContainer(ctx context.Context,
+// AddDataAPIToContainer adds the data api of the providers and its services to
+// the container.
+func AddDataAPIToContainer(ctx context.Context,
 	c *restful.Container,
 	kubeconfig *rest.Config,
 	registry *prodiverregistry.Registry,
-	ctrlSet *permission.PermissionControlSet) error {
-	handler, err := newAPIHandler(ctx, kubeconfig, registry, ctrlSet)
+	ctrlSet *permission.PermissionControlSet,
+	requireAuth func(f restful.RouteFunction) restful.RouteFunction,
+	options DataAPIOptions) error {
+	handler, err := newAPIHandler(ctx, kubeconfig, registry, ctrlSet, options)
 	if err != nil {
 		return err
 	}
@@ -31,6 +36,21 @@ func addServiceToContainer(ctx context.Context,
 
 	ws.Filter(handler.authenticate)
 
+	ws.Route(ws.GET("/discovery").
+		To(handler.discovery).
+		Doc("List the data types, groups, versions and ops the access token can access").
+		Metadata(restfulspec.KeyOpenAPITags, MODULE_TAGS).
+		Param(ws.HeaderParameter(api.AccessTokenHeader, "Access token")).
+		Returns(http.StatusOK, "Success to discover the data types", DiscoveryResponse{}))
+
+	ws.Route(ws.POST("/batch").
+		To(handler.batch).
+		Doc("Invoke a batch of data operations").
+		Metadata(restfulspec.KeyOpenAPITags, MODULE_TAGS).
+		Reads(BatchRequest{}).
+		Param(ws.HeaderParameter(api.AccessTokenHeader, "Access token")).
+		Returns(http.StatusOK, "Success to invoke the operations, with the result of each one", BatchResponse{}))
+
 	ws.Route(ws.GET("/{"+api.ParamDataType+"}/{"+api.ParamGroup+"}/{"+api.ParamVersion+"}/{"+api.ParamDataID+"}").
 		To(handler.get).
 		Doc("Get data").
@@ -49,9 +69,51 @@ func addServiceToContainer(ctx context.Context,
 		Param(ws.PathParameter(api.ParamDataType, "the data type")).
 		Param(ws.PathParameter(api.ParamGroup, "the data group")).
 		Param(ws.PathParameter(api.ParamVersion, "the data version")).
+		Param(ws.QueryParameter(serviceproxy.QueryLimit, "the max number of items in a page").DataType("integer")).
+		Param(ws.QueryParameter(serviceproxy.QueryOffset, "the offset of the page").DataType("integer")).
+		Param(ws.QueryParameter(serviceproxy.QueryContinue, "the continue of the last page, returned in page.continue")).
 		Param(ws.HeaderParameter(api.AccessTokenHeader, "Access token")).
 		Returns(http.StatusOK, "Success to get the data list with group and version", nil))
 
+	ws.Route(ws.GET(eventsPrefix+"/{"+api.ParamDataType+"}/{"+api.ParamGroup+"}/{"+api.ParamVersion+"}").
+		To(handler.events).
+		Doc("Replay the dispatched events of data after the cursor").
+		Metadata(restfulspec.KeyOpenAPITags, MODULE_TAGS).
+		Param(ws.PathParameter(api.ParamDataType, "the data type")).
+		Param(ws.PathParameter(api.ParamGroup, "the data group")).
+		Param(ws.PathParameter(api.ParamVersion, "the data version")).
+		Param(ws.QueryParameter(ParamCursor, "the cursor of the last received event, 0 to backfill").DataType("integer")).
+		Param(ws.QueryParameter(ParamLimit, "the max number of events to return").DataType("integer")).
+		Param(ws.HeaderParameter(api.AccessTokenHeader, "Access token")).
+		Returns(http.StatusOK, "Success to replay the events of data with group and version", serviceproxy.EventList{}))
+
+	ws.Route(ws.GET(eventsPrefix+"/{"+api.ParamDataType+"}/{"+api.ParamGroup+"}/{"+api.ParamVersion+"}"+watchPath).
+		To(handler.watch).
+		Doc("Watch the data change events through Server-Sent Events or WebSocket").
+		Metadata(restfulspec.KeyOpenAPITags, MODULE_TAGS).
+		Produces("text/event-stream", restful.MIME_JSON).
+		Param(ws.PathParameter(api.ParamDataType, "the data type")).
+		Param(ws.PathParameter(api.ParamGroup, "the data group")).
+		Param(ws.PathParameter(api.ParamVersion, "the data version")).
+		Param(ws.QueryParameter(ParamOp, "the ops to watch, all ops if absent").AllowMultiple(true)).
+		Param(ws.QueryParameter(ParamFilter, "the field filter, <dotted path>=<value>").AllowMultiple(true)).
+		Param(ws.QueryParameter(ParamExpression, "the CEL filter expression on event")).
+		Param(ws.QueryParameter(ParamFormat, "the format of events, legacy or cloudevents")).
+		Param(ws.QueryParameter(ParamCursor, "resume after the cursor of the last received event").DataType("integer")).
+		Param(ws.QueryParameter(ParamTicket, "the watch ticket, if the access token can't be sent in header")).
+		Param(ws.HeaderParameter(api.AccessTokenHeader, "Access token")).
+		Returns(http.StatusOK, "Streaming the data change events with group and version", serviceproxy.DispatchRequest{}))
+
+	ws.Route(ws.POST(eventsPrefix+"/{"+api.ParamDataType+"}/{"+api.ParamGroup+"}/{"+api.ParamVersion+"}"+watchPath+"/ticket").
+		To(handler.watchTicket).
+		Doc("Issue a ticket to open a watch stream once without the access token in header").
+		Metadata(restfulspec.KeyOpenAPITags, MODULE_TAGS).
+		Param(ws.PathParameter(api.ParamDataType, "the data type")).
+		Param(ws.PathParameter(api.ParamGroup, "the data group")).
+		Param(ws.PathParameter(api.ParamVersion, "the data version")).
+		Param(ws.HeaderParameter(api.AccessTokenHeader, "Access token")).
+		Returns(http.StatusOK, "Success to issue a watch ticket", WatchTicket{}))
+
 	ws.Route(ws.POST("/{"+api.ParamDataType+"}/{"+api.ParamGroup+"}/{"+api.ParamVersion+"}").
 		To(handler.create).
 		Doc("create data").
@@ -97,5 +159,46 @@ func addServiceToContainer(ctx context.Context,
 
 	c.Add(ws)
 
+	dlws := newDeadLetterWebService()
+
+	dlws.Route(dlws.GET("").
+		To(requireAuth(handler.listDeadLetters)).
+		Doc("List the watcher deliveries in the dead-letter store").
+		Metadata(restfulspec.KeyOpenAPITags, MODULE_TAGS).
+		Returns(http.StatusOK, "Success to list the dead letters", []serviceproxy.Delivery{}))
+
+	dlws.Route(dlws.GET("/{"+ParamDeliveryID+"}").
+		To(requireAuth(handler.getDeadLetter)).
+		Doc("Get a dead letter").
+		Metadata(restfulspec.KeyOpenAPITags, MODULE_TAGS).
+		Param(dlws.PathParameter(ParamDeliveryID, "the delivery id")).
+		Returns(http.StatusOK, "Success to get the dead letter", serviceproxy.Delivery{}))
+
+	dlws.Route(dlws.POST("/{"+ParamDeliveryID+"}/redrive").
+		To(requireAuth(handler.redriveDeadLetter)).
+		Doc("Redrive a dead letter to its watcher").
+		Metadata(restfulspec.KeyOpenAPITags, MODULE_TAGS).
+		Param(dlws.PathParameter(ParamDeliveryID, "the delivery id")).
+		Returns(http.StatusOK, "Success to redrive the dead letter", nil))
+
+	dlws.Route(dlws.DELETE("/{"+ParamDeliveryID+"}").
+		To(requireAuth(handler.discardDeadLetter)).
+		Doc("Discard a dead letter").
+		Metadata(restfulspec.KeyOpenAPITags, MODULE_TAGS).
+		Param(dlws.PathParameter(ParamDeliveryID, "the delivery id")).
+		Returns(http.StatusOK, "Success to discard the dead letter", nil))
+
+	c.Add(dlws)
+
+	whws := newWebhookWebService()
+
+	whws.Route(whws.GET("/publickey").
+		To(handler.publicKey).
+		Doc("Get the public key to verify the signed watcher callbacks").
+		Metadata(restfulspec.KeyOpenAPITags, MODULE_TAGS).
+		Returns(http.StatusOK, "Success to get the public key", PublicKeyResponse{}))
+
+	c.Add(whws)
+
 	return nil
 }
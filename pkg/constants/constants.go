@@ -1,8 +1,11 @@
 package constants
 
 import (
+	"fmt"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -11,17 +14,61 @@ const (
 	ProxyServerServiceName    = "system-server"
 	ProxyServerListenAddress  = ":28080"
 	APIServerListenAddress    = ":80"
+	APIServerTLSListenAddress = ":443"
 	KubeSphereClientAttribute = "ksclient"
 	AuthorizationTokenKey     = "X-Authorization"
 	BflUserKey                = "X-BFL-USER"
 	AuthTokenCookieName       = "auth_token"
 	AutheliaNonceKey          = "Authelia-Nonce"
+	DefaultDBPath             = "/data/system-server.db"
+	DefaultSigningKeyPath     = "/data/signing.key"
+	DefaultTracingEndpoint    = "localhost:4317"
 )
 
 var (
 	MyNamespace string
 	Owner       string
 	MyUserspace string
+	DBPath      string
+
+	// SigningKeyPath is the ed25519 key to sign the watcher callbacks.
+	SigningKeyPath string
+
+	// WatcherWorkers is the number of concurrent deliveries per watcher, 0 for default,
+	// more than 1 delivers the callbacks of a watcher out of order.
+	WatcherWorkers int
+
+	// EventRetentionCount is the number of events kept per data type, 0 for default.
+	EventRetentionCount int
+
+	// EventRetentionAge is the max age of events in the event log, 0 for default.
+	EventRetentionAge time.Duration
+
+	// CacheMaxEntries is the max number of cached provider responses, 0 for default.
+	CacheMaxEntries int
+
+	// the limits of the proxied websocket connections, 0 for defaults, the max
+	// connections are counted per app or per client address if unauthenticated
+	WebsocketPingPeriod      time.Duration
+	WebsocketIdleTimeout     time.Duration
+	WebsocketMaxMessageSize  int64
+	WebsocketMaxConnsPerUser int
+
+	// MaxRequestBodySize is the default max bytes of the request bodies proxied to
+	// the legacy apis, 0 for unlimited.
+	MaxRequestBodySize int64
+
+	// MTLSCertTTL is the lifetime of the certificates issued by the internal CA,
+	// 0 for default.
+	MTLSCertTTL time.Duration
+
+	// TracingEndpoint is the OTLP gRPC endpoint of the collector, host:port of a
+	// local collector in plaintext, or an http(s) url.
+	TracingEndpoint string
+
+	// TracingSampleRatio is the ratio of the traces started by system-server to
+	// sample, the traces of callers are sampled as the callers decide.
+	TracingSampleRatio float64
 )
 
 var (
@@ -32,4 +79,77 @@ func init() {
 	MyNamespace = os.Getenv("MY_NAMESPACE")
 	Owner = os.Getenv("OWNER")
 	MyUserspace = strings.Replace(MyNamespace, "user-system-", "user-space-", 1)
+
+	DBPath = os.Getenv("DB_PATH")
+	if DBPath == "" {
+		DBPath = DefaultDBPath
+	}
+
+	SigningKeyPath = os.Getenv("SIGNING_KEY_PATH")
+	if SigningKeyPath == "" {
+		SigningKeyPath = DefaultSigningKeyPath
+	}
+
+	TracingEndpoint = os.Getenv("TRACING_ENDPOINT")
+	if TracingEndpoint == "" {
+		TracingEndpoint = DefaultTracingEndpoint
+	}
+
+	TracingSampleRatio = 1
+	if ratio, err := strconv.ParseFloat(os.Getenv("TRACING_SAMPLE_RATIO"), 64); err == nil {
+		TracingSampleRatio = ratio
+	}
+}
+
+// SetFromEnv sets the tunables in the env, the unset ones keep their defaults.
+// An invalid value is an error, the server never starts with the limits it's
+// not asked for.
+func SetFromEnv() error {
+	for _, v := range []struct {
+		env   string
+		parse func(string) error
+	}{
+		{"WATCHER_WORKERS", intVar(&WatcherWorkers)},
+		{"EVENT_RETENTION_COUNT", intVar(&EventRetentionCount)},
+		{"EVENT_RETENTION", durationVar(&EventRetentionAge)},
+		{"CACHE_MAX_ENTRIES", intVar(&CacheMaxEntries)},
+		{"WS_PING_PERIOD", durationVar(&WebsocketPingPeriod)},
+		{"WS_IDLE_TIMEOUT", durationVar(&WebsocketIdleTimeout)},
+		{"WS_MAX_MESSAGE_SIZE", int64Var(&WebsocketMaxMessageSize)},
+		{"WS_MAX_CONNS_PER_USER", intVar(&WebsocketMaxConnsPerUser)},
+		{"MAX_REQUEST_BODY_SIZE", int64Var(&MaxRequestBodySize)},
+		{"MTLS_CERT_TTL", durationVar(&MTLSCertTTL)},
+	} {
+		value, ok := os.LookupEnv(v.env)
+		if !ok || value == "" {
+			continue
+		}
+
+		if err := v.parse(value); err != nil {
+			return fmt.Errorf("invalid %s %q, %w", v.env, value, err)
+		}
+	}
+
+	return nil
+}
+
+func intVar(p *int) func(string) error {
+	return func(value string) (err error) {
+		*p, err = strconv.Atoi(value)
+		return
+	}
+}
+
+func int64Var(p *int64) func(string) error {
+	return func(value string) (err error) {
+		*p, err = strconv.ParseInt(value, 10, 64)
+		return
+	}
+}
+
+func durationVar(p *time.Duration) func(string) error {
+	return func(value string) (err error) {
+		*p, err = time.ParseDuration(value)
+		return
+	}
 }
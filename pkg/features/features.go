@@ -0,0 +1,98 @@
+package features
+
+import (
+	"fmt"
+	"os"
+
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/component-base/featuregate"
+)
+
+// The API groups of system-server, enabled or disabled at startup with
+// --feature-gates or the FEATURE_GATES env, e.g. LegacyAPIV1=true,DataAPI=false
+const (
+	// DataAPI is the data api of the providers, /system-server/v1alpha1/<datatype>/<group>/<version>,
+	// with its events, watch, batch, discovery, dead letters and webhook services.
+	DataAPI featuregate.Feature = "DataAPI"
+
+	// LegacyAPIV1 is the legacy proxy of the legacy_api providers, /legacy/v1alpha1.
+	LegacyAPIV1 featuregate.Feature = "LegacyAPIV1"
+
+	// LegacyAPIV2 is the legacy proxy authorized by the app key, /system-server/v2,
+	// and the grpc calls to the legacy_api providers.
+	LegacyAPIV2 featuregate.Feature = "LegacyAPIV2"
+
+	// PermissionV1 is the v1 permission api issuing the access tokens.
+	PermissionV1 featuregate.Feature = "PermissionV1"
+
+	// PermissionV2 is the v2 permission api of the RBAC.
+	PermissionV2 featuregate.Feature = "PermissionV2"
+
+	// ProviderV2 is the v2 provider registry api.
+	ProviderV2 featuregate.Feature = "ProviderV2"
+
+	// RBACProxy is the embedded RBAC proxy in front of the providers.
+	RBACProxy featuregate.Feature = "RBACProxy"
+
+	// ProviderMTLS issues the certificates of the internal CA to system-server and
+	// the providers, and calls the providers with mTLS.
+	ProviderMTLS featuregate.Feature = "ProviderMTLS"
+
+	// ProblemDetails writes the errors as RFC 7807 problem details with the http
+	// status of the error, or the legacy envelope with http 200 and plain text
+	// errors as before if disabled. It's off by default, the clients reading the
+	// code of the envelope break once it's on.
+	ProblemDetails featuregate.Feature = "ProblemDetails"
+
+	// Tracing exports the spans of the requests to an OTLP collector, and
+	// propagates the W3C trace context to the providers and watchers.
+	Tracing featuregate.Feature = "Tracing"
+)
+
+var defaultFeatureGates = map[featuregate.Feature]featuregate.FeatureSpec{
+	DataAPI:        {Default: false, PreRelease: featuregate.Beta},
+	LegacyAPIV1:    {Default: false, PreRelease: featuregate.Deprecated},
+	LegacyAPIV2:    {Default: false, PreRelease: featuregate.Deprecated},
+	PermissionV1:   {Default: true, PreRelease: featuregate.GA},
+	PermissionV2:   {Default: true, PreRelease: featuregate.GA},
+	ProviderV2:     {Default: true, PreRelease: featuregate.GA},
+	RBACProxy:      {Default: true, PreRelease: featuregate.GA},
+	ProviderMTLS:   {Default: false, PreRelease: featuregate.Alpha},
+	ProblemDetails: {Default: false, PreRelease: featuregate.Beta},
+	Tracing:        {Default: false, PreRelease: featuregate.Alpha},
+}
+
+var (
+	// DefaultMutableFeatureGate is the feature gate of system-server, set by the
+	// flags and env at startup.
+	DefaultMutableFeatureGate featuregate.MutableFeatureGate = featuregate.NewFeatureGate()
+
+	// DefaultFeatureGate is the read-only view of DefaultMutableFeatureGate.
+	DefaultFeatureGate featuregate.FeatureGate = DefaultMutableFeatureGate
+)
+
+func init() {
+	runtime.Must(DefaultMutableFeatureGate.Add(defaultFeatureGates))
+}
+
+// SetFromEnv sets the feature gates in the FEATURE_GATES env, it must be called
+// before parsing the flags, so that the flag overrides the env. An unknown gate
+// or an invalid value is an error, the server never starts with the gates it's
+// not asked for.
+func SetFromEnv() error {
+	gates := os.Getenv("FEATURE_GATES")
+	if gates == "" {
+		return nil
+	}
+
+	if err := DefaultMutableFeatureGate.Set(gates); err != nil {
+		return fmt.Errorf("invalid FEATURE_GATES %q, %w", gates, err)
+	}
+
+	return nil
+}
+
+// Enabled returns whether the feature is enabled.
+func Enabled(f featuregate.Feature) bool {
+	return DefaultFeatureGate.Enabled(f)
+}
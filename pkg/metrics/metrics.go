@@ -0,0 +1,187 @@
+// Package metrics holds the prometheus metrics of system-server, served at
+// /metrics of the api server.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/component-base/metrics/legacyregistry"
+
+	// the workqueue metrics of the controllers in the legacy registry
+	_ "k8s.io/component-base/metrics/prometheus/workqueue"
+)
+
+const namespace = "system_server"
+
+var (
+	// Registry is the registry of the metrics of system-server, served with the
+	// legacy registry of the kubernetes libraries, with the go and process metrics.
+	Registry = prometheus.NewRegistry()
+
+	// HTTPRequests is the requests to the api server by the route template, so
+	// the path parameters don't explode the series. The grpc calls are of the
+	// route grpc, with the grpc status as the code.
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Requests to the api server by route, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of the requests to the api server by route and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	// ProviderRequests is the calls to the providers, result is success or the
+	// reason of the error.
+	ProviderRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "provider_requests_total",
+		Help:      "Calls to the providers by provider, op and result.",
+	}, []string{"provider", "op", "result"})
+
+	ProviderRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "provider_request_duration_seconds",
+		Help:      "Latency of the calls to the providers by provider and op.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"provider", "op"})
+
+	// RBACProxyRequests is the requests through the rbac proxy, service is the
+	// provider service authorized, empty if it's denied.
+	RBACProxyRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rbac_proxy_requests_total",
+		Help:      "Requests through the rbac proxy by provider service, method and status code.",
+	}, []string{"service", "method", "code"})
+
+	RBACProxyRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "rbac_proxy_request_duration_seconds",
+		Help:      "Latency of the requests through the rbac proxy by provider service.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"service"})
+
+	// Authentications is the attempts of every authenticator, result is success,
+	// failure or skipped if the request has no credentials for it.
+	Authentications = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "authentication_attempts_total",
+		Help:      "Authentication attempts by authenticator and result.",
+	}, []string{"authenticator", "result"})
+
+	// AuthorizationDecisions is the decisions of every authorizer asked, allow,
+	// deny or no-opinion.
+	AuthorizationDecisions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "authorization_decisions_total",
+		Help:      "Authorization decisions by authorizer and decision.",
+	}, []string{"authorizer", "decision"})
+
+	// AccessTokenValidations is the validations of the access tokens of the data
+	// api, result is allowed, denied or unknown if the token is not found.
+	AccessTokenValidations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "access_token_validations_total",
+		Help:      "Validations of the access tokens of the data api by result.",
+	}, []string{"result"})
+
+	// TokenCacheRequests is the lookups of the token caches, hit or miss.
+	TokenCacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "token_cache_requests_total",
+		Help:      "Lookups of the token caches by cache and result.",
+	}, []string{"cache", "result"})
+
+	// Deliveries is the attempts to deliver the callbacks to the watchers, outcome
+	// is delivered, failed (to be retried) or dead.
+	Deliveries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "dispatcher_deliveries_total",
+		Help:      "Delivery attempts of the watcher callbacks by watcher and outcome.",
+	}, []string{"watcher", "outcome"})
+
+	// DispatcherQueueDepth is the deliveries waiting in the queue of every watcher,
+	// the series is deleted with the watcher.
+	DispatcherQueueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "dispatcher_queue_depth",
+		Help:      "Deliveries waiting in the queue of the watcher.",
+	}, []string{"watcher"})
+
+	// WebsocketConnections is the open websocket connections, kind is proxy for
+	// the proxied connections or watch for the watch streams.
+	WebsocketConnections = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "websocket_connections",
+		Help:      "Open websocket connections by kind.",
+	}, []string{"kind"})
+
+	SSEStreams = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "sse_streams",
+		Help:      "Open server-sent events watch streams.",
+	})
+)
+
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+	ResultSkipped = "skipped"
+
+	ResultHit  = "hit"
+	ResultMiss = "miss"
+)
+
+func init() {
+	Registry.MustRegister(
+		HTTPRequests,
+		HTTPRequestDuration,
+		ProviderRequests,
+		ProviderRequestDuration,
+		RBACProxyRequests,
+		RBACProxyRequestDuration,
+		Authentications,
+		AuthorizationDecisions,
+		AccessTokenValidations,
+		TokenCacheRequests,
+		Deliveries,
+		DispatcherQueueDepth,
+		WebsocketConnections,
+		SSEStreams,
+	)
+}
+
+// Handler serves the metrics in the prometheus exposition format.
+func Handler() http.Handler {
+	gatherers := prometheus.Gatherers{Registry, legacyregistry.DefaultGatherer}
+	return promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// CacheResult returns the result label of a cache lookup.
+func CacheResult(hit bool) string {
+	if hit {
+		return ResultHit
+	}
+
+	return ResultMiss
+}
+
+// MethodOther is the method label of the requests of a non-standard method.
+const MethodOther = "OTHER"
+
+// Method returns the method label of a request, the client chooses the method
+// so anything but the standard methods is MethodOther, the series are bounded.
+func Method(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+
+	return MethodOther
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	sysv1alpha1 "bytetrade.io/web3os/system-server/pkg/apis/sys/v1alpha1"
+	"bytetrade.io/web3os/system-server/pkg/metrics"
 	"bytetrade.io/web3os/system-server/pkg/utils"
 
 	"github.com/jellydator/ttlcache/v3"
@@ -21,6 +22,8 @@ const (
 	TokenCacheCapacity = 1000
 )
 
+var errTokenNotFound = errors.New("token not found in cache or expired")
+
 type AccessManager struct {
 	cache *ttlcache.Cache[string, *sysv1alpha1.PermissionRequire]
 }
@@ -56,9 +59,21 @@ func (a *AccessManager) cacheAccessToken(token string, permReq *sysv1alpha1.Perm
 
 func (a *AccessManager) getPermWithToken(token string) (*sysv1alpha1.PermissionRequire, error) {
 	perm := a.cache.Get(token)
+	metrics.TokenCacheRequests.WithLabelValues("access_token", metrics.CacheResult(perm != nil)).Inc()
 	if perm == nil {
-		return nil, errors.New("token not found in cache or expired")
+		return nil, errTokenNotFound
 	}
 
 	return perm.Value(), nil
 }
+
+// peekPermWithToken returns the permission of the token, without extending its
+// ttl or counting the lookup.
+func (a *AccessManager) peekPermWithToken(token string) (*sysv1alpha1.PermissionRequire, bool) {
+	perm := a.cache.Get(token, ttlcache.WithDisableTouchOnHit[string, *sysv1alpha1.PermissionRequire]())
+	if perm == nil {
+		return nil, false
+	}
+
+	return perm.Value(), true
+}
@@ -25,20 +25,28 @@ const (
 type PermissionControl struct {
 	permissionLister    v1alpha1.ApplicationPermissionLister
 	permissionClientset clientset.Interface
+	namespace           string
 	rand                *rand.Rand
 }
 
 func NewPermissionControl(clientset clientset.Interface, lister v1alpha1.ApplicationPermissionLister) *PermissionControl {
+	return NewPermissionControlInNamespace(clientset, lister, constants.MyNamespace)
+}
+
+// NewPermissionControlInNamespace returns the control of the ApplicationPermissions
+// in namespace.
+func NewPermissionControlInNamespace(clientset clientset.Interface, lister v1alpha1.ApplicationPermissionLister, namespace string) *PermissionControl {
 
 	return &PermissionControl{
 		permissionLister:    lister,
 		permissionClientset: clientset,
+		namespace:           namespace,
 		rand:                rand.New(rand.NewSource(time.Now().Unix())),
 	}
 }
 
 func (p *PermissionControl) getAppPermissionFromAppKey(_ context.Context, appkey string) (*sysv1alpha1.ApplicationPermission, error) {
-	aps, err := p.permissionLister.ApplicationPermissions(constants.MyNamespace).List(labels.Everything())
+	aps, err := p.permissionLister.ApplicationPermissions(p.namespace).List(labels.Everything())
 	if err != nil {
 		return nil, err
 	}
@@ -68,7 +76,7 @@ func (p *PermissionControl) verifyPermission(appPerm *sysv1alpha1.ApplicationPer
 }
 
 func (p *PermissionControl) applyPermission(ctx context.Context, permReg *PermissionRegister) (*RegisterResp, error) {
-	oldAP, err := p.permissionLister.ApplicationPermissions(constants.MyNamespace).
+	oldAP, err := p.permissionLister.ApplicationPermissions(p.namespace).
 		Get(permReg.App)
 	if err != nil && !apierrors.IsNotFound(err) {
 		return nil, err
@@ -102,7 +110,7 @@ func (p *PermissionControl) applyPermission(ctx context.Context, permReg *Permis
 		appPerm.Spec.Key = k
 		appPerm.Spec.Secret = s
 		if _, err = p.permissionClientset.SysV1alpha1().
-			ApplicationPermissions(constants.MyNamespace).
+			ApplicationPermissions(p.namespace).
 			Create(ctx, &appPerm, metav1.CreateOptions{}); err != nil {
 			return nil, err
 		}
@@ -111,7 +119,7 @@ func (p *PermissionControl) applyPermission(ctx context.Context, permReg *Permis
 		appPerm.Spec.Secret = oldAP.Spec.Secret
 		oldAP.Spec.Permission = appPerm.Spec.Permission
 		if _, err = p.permissionClientset.SysV1alpha1().
-			ApplicationPermissions(constants.MyNamespace).
+			ApplicationPermissions(p.namespace).
 			Update(ctx, oldAP, metav1.UpdateOptions{}); err != nil {
 			return nil, err
 		}
@@ -124,7 +132,7 @@ func (p *PermissionControl) applyPermission(ctx context.Context, permReg *Permis
 }
 
 func (p *PermissionControl) deletePermission(ctx context.Context, name string) error {
-	_, err := p.permissionLister.ApplicationPermissions(constants.MyNamespace).
+	_, err := p.permissionLister.ApplicationPermissions(p.namespace).
 		Get(name)
 	if err != nil {
 		if apierrors.IsNotFound(err) {
@@ -134,7 +142,7 @@ func (p *PermissionControl) deletePermission(ctx context.Context, name string) e
 		return err
 	}
 
-	return p.permissionClientset.SysV1alpha1().ApplicationPermissions(constants.MyNamespace).
+	return p.permissionClientset.SysV1alpha1().ApplicationPermissions(p.namespace).
 		Delete(ctx, name, metav1.DeleteOptions{})
 }
 
@@ -3,11 +3,9 @@ package permission
 import (
 	"errors"
 	"fmt"
-	"time"
 
 	"bytetrade.io/web3os/system-server/pkg/apiserver/v1alpha1/api"
 	"bytetrade.io/web3os/system-server/pkg/apiserver/v1alpha1/api/response"
-	"bytetrade.io/web3os/system-server/pkg/constants"
 
 	"github.com/emicklei/go-restful/v3"
 	"k8s.io/client-go/kubernetes"
@@ -43,31 +41,17 @@ func (h *Handler) auth(req *restful.Request, resp *restful.Response) {
 		return
 	}
 
-	appPerm, err := h.permissionCtrl.getAppPermissionFromAppKey(req.Request.Context(), accReq.AppKey)
-	if err != nil {
-		response.HandleError(resp, err)
+	token, err := IssueAccessToken(req.Request.Context(), &accReq,
+		&PermissionControlSet{Ctrl: h.permissionCtrl, Mgr: h.accessMgr})
+	switch {
+	case errors.Is(err, ErrPermissionNotAllowed):
+		response.HandleForbidden(resp, err)
 		return
-	}
-
-	authToken, err := h.accessMgr.getAccessToken(&accReq, appPerm)
-	if err != nil {
+	case err != nil:
 		response.HandleError(resp, err)
 		return
 	}
 
-	if !h.permissionCtrl.verifyPermission(appPerm, &accReq.Perm) {
-		response.HandleForbidden(resp, errors.New("permission required is not allowed"))
-		return
-	}
-
-	accReq.Perm.AppKey = accReq.AppKey
-	h.accessMgr.cacheAccessToken(authToken, &accReq.Perm)
-
-	token := AccessTokenResponse{
-		AccessToken: authToken,
-		ExpiredAt:   time.Now().Add(TokenCacheTTL),
-	}
-
 	response.Success(resp, token)
 }
 
@@ -80,7 +64,7 @@ func (h *Handler) register(req *restful.Request, resp *restful.Response) {
 		return
 	}
 
-	if constants.MyNamespace != "user-system-"+user {
+	if h.permissionCtrl.namespace != "user-system-"+user {
 		api.HandleUnauthorized(resp, req, fmt.Errorf("invalid user, %s", user))
 		return
 	}
@@ -110,7 +94,7 @@ func (h *Handler) unregister(req *restful.Request, resp *restful.Response) {
 		return
 	}
 
-	if constants.MyNamespace != "user-system-"+user {
+	if h.permissionCtrl.namespace != "user-system-"+user {
 		api.HandleUnauthorized(resp, req, fmt.Errorf("invalid user, %s", user))
 		return
 	}
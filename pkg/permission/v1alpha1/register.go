@@ -5,6 +5,7 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
@@ -14,11 +15,15 @@ import (
 	"bytetrade.io/web3os/system-server/pkg/apiserver/v1alpha1/api"
 	"bytetrade.io/web3os/system-server/pkg/constants"
 	sysclientset "bytetrade.io/web3os/system-server/pkg/generated/clientset/versioned"
+	"bytetrade.io/web3os/system-server/pkg/metrics"
 	prodiverregistry "bytetrade.io/web3os/system-server/pkg/providerregistry/v1alpha1"
 	serviceproxy "bytetrade.io/web3os/system-server/pkg/serviceproxy/v1alpha1"
+	"bytetrade.io/web3os/system-server/pkg/tracing"
 
 	restfulspec "github.com/emicklei/go-restful-openapi/v2"
 	"github.com/emicklei/go-restful/v3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/rest"
@@ -58,17 +63,59 @@ func newWebService() *restful.WebService {
 	return &webservice
 }
 
+// ErrPermissionNotAllowed is returned if the app requests an access token of the
+// permission it's not granted.
+var ErrPermissionNotAllowed = errors.New("permission required is not allowed")
+
+// IssueAccessToken issues the access token of the permission the app requests,
+// signed with the secret of its ApplicationPermission.
+func IssueAccessToken(ctx context.Context, accReq *AccessTokenRequest, ctrlSet *PermissionControlSet) (*AccessTokenResponse, error) {
+	appPerm, err := ctrlSet.Ctrl.getAppPermissionFromAppKey(ctx, accReq.AppKey)
+	if err != nil {
+		return nil, err
+	}
+
+	authToken, err := ctrlSet.Mgr.getAccessToken(accReq, appPerm)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ctrlSet.Ctrl.verifyPermission(appPerm, &accReq.Perm) {
+		return nil, ErrPermissionNotAllowed
+	}
+
+	perm := accReq.Perm.DeepCopy()
+	perm.AppKey = accReq.AppKey
+	ctrlSet.Mgr.cacheAccessToken(authToken, perm)
+
+	return &AccessTokenResponse{
+		AccessToken: authToken,
+		ExpiredAt:   time.Now().Add(TokenCacheTTL),
+	}, nil
+}
+
 func ValidateAccessTokenWithRequest(token string, op string, req *restful.Request, ctrlSet *PermissionControlSet) (string, error) {
 	datatype := req.PathParameter(api.ParamDataType)
 	version := req.PathParameter(api.ParamVersion)
 	group := req.PathParameter(api.ParamGroup)
 
-	return ValidateAccessToken(token, op, datatype, version, group, ctrlSet)
+	_, span := tracing.Start(req.Request.Context(), "authorize access token", trace.WithAttributes(
+		attribute.String("op", op),
+		attribute.String("data_type", datatype),
+		attribute.String("group", group),
+		attribute.String("version", version),
+	))
+	appKey, err := ValidateAccessToken(token, op, datatype, version, group, ctrlSet)
+	span.SetAttributes(attribute.String("app_key", appKey))
+	tracing.End(span, err)
+
+	return appKey, err
 }
 
 func ValidateAccessToken(token string, op, datatype, version, group string, ctrlSet *PermissionControlSet) (string, error) {
 	permReq, err := ctrlSet.Mgr.getPermWithToken(token)
 	if err != nil {
+		metrics.AccessTokenValidations.WithLabelValues("unknown").Inc()
 		return "", err
 	}
 
@@ -82,12 +129,77 @@ func ValidateAccessToken(token string, op, datatype, version, group string, ctrl
 	}
 
 	if permReq.Include(&accReq, true) {
+		metrics.AccessTokenValidations.WithLabelValues("allowed").Inc()
 		return permReq.AppKey, nil
 	}
 
+	metrics.AccessTokenValidations.WithLabelValues("denied").Inc()
 	return "", errors.New("data access denied")
 }
 
+// AccessTokenAlive returns whether the access token is still cached, it's not
+// extended by the check.
+func AccessTokenAlive(token string, ctrlSet *PermissionControlSet) bool {
+	_, ok := ctrlSet.Mgr.peekPermWithToken(token)
+	return ok
+}
+
+// AccessTokenAllows returns whether the access token is granted the op of data, as
+// ValidateAccessToken does without side effects, the ttl of the token is not
+// extended and the validation is not counted.
+func AccessTokenAllows(token string, op, datatype, version, group string, ctrlSet *PermissionControlSet) bool {
+	permReq, ok := ctrlSet.Mgr.peekPermWithToken(token)
+	if !ok {
+		return false
+	}
+
+	return permReq.Include(&sysv1alpha1.PermissionRequire{
+		Group:    group,
+		DataType: datatype,
+		Version:  version,
+		Ops: []string{
+			op,
+		},
+	}, true)
+}
+
+// ExplainAccessToken validates the access token as ValidateAccessToken does, and
+// explains the decision with the permission the token is granted. The ttl of the
+// token is not extended and the validation is not counted.
+func ExplainAccessToken(token string, op, datatype, version, group string, ctrlSet *PermissionControlSet) *AccessExplanation {
+	e := &AccessExplanation{
+		Required: sysv1alpha1.PermissionRequire{
+			Group:    group,
+			DataType: datatype,
+			Version:  version,
+			Ops: []string{
+				op,
+			},
+		},
+	}
+
+	permReq, ok := ctrlSet.Mgr.peekPermWithToken(token)
+	if !ok {
+		e.Reason = errTokenNotFound.Error()
+		return e
+	}
+
+	e.Granted = permReq.DeepCopy()
+	e.AppKey = permReq.AppKey
+	switch {
+	case permReq.Include(&e.Required, true):
+		e.Allowed = true
+		e.Reason = "access token is granted " + op
+	case !permReq.Include(&sysv1alpha1.PermissionRequire{Group: group, DataType: datatype, Version: version}, true):
+		e.Reason = fmt.Sprintf("data access denied, access token is granted %s/%s/%s, not %s/%s/%s",
+			permReq.DataType, permReq.Group, permReq.Version, datatype, group, version)
+	default:
+		e.Reason = fmt.Sprintf("data access denied, access token is granted %v, not %s", permReq.Ops, op)
+	}
+
+	return e
+}
+
 func ValidateAppKeyWithRequest(appKey string, req *restful.Request) error {
 	datatype := req.PathParameter(api.ParamDataType)
 	version := req.PathParameter(api.ParamVersion)
@@ -33,3 +33,16 @@ type RegisterResp struct {
 	AppKey    string `json:"app_key"`
 	AppSecret string `json:"app_secret"`
 }
+
+// AccessExplanation is the trace of validating an access token.
+type AccessExplanation struct {
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason"`
+	AppKey  string `json:"app_key,omitempty"`
+
+	// Granted is the permission of the access token, nil if it's not found.
+	Granted *sysv1alpha1.PermissionRequire `json:"granted,omitempty"`
+
+	// Required is the permission of the call.
+	Required sysv1alpha1.PermissionRequire `json:"required"`
+}
@@ -8,8 +8,11 @@ import (
 	"time"
 
 	"bytetrade.io/web3os/system-server/pkg/constants"
+	"bytetrade.io/web3os/system-server/pkg/metrics"
 	"github.com/brancz/kube-rbac-proxy/pkg/authn"
 	"github.com/jellydator/ttlcache/v3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"k8s.io/apiserver/pkg/authentication/authenticator"
 	"k8s.io/apiserver/pkg/authentication/request/union"
 	"k8s.io/apiserver/pkg/authentication/user"
@@ -49,6 +52,7 @@ func (l *lldapTokenAuthenticator) AuthenticateRequest(req *http.Request) (*authe
 	}
 
 	claims := l.tokenCache.Get(token)
+	metrics.TokenCacheRequests.WithLabelValues("lldap", metrics.CacheResult(claims != nil)).Inc()
 	if claims != nil {
 		klog.Info("found token in cache")
 		return &authenticator.Response{
@@ -120,8 +124,36 @@ func (a *autheliaNonceAuthenticator) AuthenticateRequest(req *http.Request) (*au
 	return &response, true, nil
 }
 
+// namedAuthenticator records the attempts of the authenticator by name.
+type namedAuthenticator struct {
+	authenticator.Request
+	name string
+}
+
+func (n namedAuthenticator) AuthenticateRequest(req *http.Request) (*authenticator.Response, bool, error) {
+	res, ok, err := n.Request.AuthenticateRequest(req)
+
+	result := metrics.ResultSuccess
+	switch {
+	case err != nil:
+		result = metrics.ResultFailure
+	case !ok:
+		result = metrics.ResultSkipped
+	}
+	metrics.Authentications.WithLabelValues(n.name, result).Inc()
+	trace.SpanFromContext(req.Context()).AddEvent("authenticator", trace.WithAttributes(
+		attribute.String("authenticator", n.name),
+		attribute.String("result", result),
+	))
+
+	return res, ok, err
+}
+
 func UnionAllAuthenticators(ctx context.Context, cfg *AuthnConfig, kubeClient kubernetes.Interface) (authenticator.Request, error) {
-	var authenticator authenticator.Request
+	var (
+		authenticator authenticator.Request
+		name          string
+	)
 
 	// If OIDC configuration provided, use oidc authenticator
 	if cfg.OIDC.IssuerURL != "" {
@@ -131,7 +163,7 @@ func UnionAllAuthenticators(ctx context.Context, cfg *AuthnConfig, kubeClient ku
 		}
 
 		go oidcAuthenticator.Run(ctx)
-		authenticator = oidcAuthenticator
+		authenticator, name = oidcAuthenticator, "oidc"
 	} else {
 		//Use Delegating authenticator
 		klog.Infof("Valid token audiences: %s", strings.Join(cfg.Token.Audiences, ", "))
@@ -143,15 +175,15 @@ func UnionAllAuthenticators(ctx context.Context, cfg *AuthnConfig, kubeClient ku
 		}
 
 		go delegatingAuthenticator.Run(ctx)
-		authenticator = delegatingAuthenticator
+		authenticator, name = delegatingAuthenticator, "delegating"
 	}
 
 	return union.New(
-		&lldapTokenAuthenticator{ttlcache.New(
+		namedAuthenticator{&lldapTokenAuthenticator{ttlcache.New(
 			ttlcache.WithTTL[string, *Claims](tokenCacheTTL),
 			ttlcache.WithCapacity[string, *Claims](1000),
 		), fmt.Sprintf("http://%s:%d", cfg.LLDAP.Server, cfg.LLDAP.Port),
-		},
-		&autheliaNonceAuthenticator{},
-		authenticator), nil
+		}, "lldap"},
+		namedAuthenticator{&autheliaNonceAuthenticator{}, "authelia"},
+		namedAuthenticator{authenticator, name}), nil
 }
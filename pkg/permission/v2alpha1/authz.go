@@ -6,8 +6,11 @@ import (
 	"fmt"
 	"strings"
 
+	"bytetrade.io/web3os/system-server/pkg/metrics"
 	providerv2alpha1 "bytetrade.io/web3os/system-server/pkg/providerregistry/v2alpha1"
 	"github.com/brancz/kube-rbac-proxy/pkg/authz"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	rbacv1 "k8s.io/api/rbac/v1"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apiserver/pkg/authentication/user"
@@ -74,9 +77,23 @@ func (v *authorizingVisitor) visit(source fmt.Stringer, role *rbacv1.ClusterRole
 }
 
 func (r *nonResourceWithServiceRBACAuthorizor) Authorize(ctx context.Context, requestAttributes authorizer.Attributes) (string, authorizer.Decision, string, error) {
+	return r.authorize(ctx, requestAttributes, nil)
+}
+
+// authorize authorizes the request, the bindings visited are traced if trace is not nil.
+func (r *nonResourceWithServiceRBACAuthorizor) authorize(ctx context.Context, requestAttributes authorizer.Attributes, trace func(BindingTrace)) (string, authorizer.Decision, string, error) {
 	ruleCheckingVisitor := &authorizingVisitor{requestAttributes: requestAttributes}
 
-	r.resolver.VisitRulesFor(ctx, requestAttributes.GetUser(), requestAttributes.GetResource(), ruleCheckingVisitor.visit)
+	visit := ruleCheckingVisitor.visit
+	if trace != nil {
+		visit = func(source fmt.Stringer, role *rbacv1.ClusterRole, rule *rbacv1.PolicyRule, err error) bool {
+			next := ruleCheckingVisitor.visit(source, role, rule, err)
+			trace(newBindingTrace(source, role, rule, err, rule != nil && ruleCheckingVisitor.allowed))
+			return next
+		}
+	}
+
+	r.resolver.VisitRulesFor(ctx, requestAttributes.GetUser(), requestAttributes.GetResource(), visit)
 	if ruleCheckingVisitor.allowed {
 		return ruleCheckingVisitor.service, authorizer.DecisionAllow, ruleCheckingVisitor.reason, nil
 	}
@@ -139,15 +156,15 @@ func (rr *nonResourceWithServiceRuleResolver) VisitRulesFor(ctx context.Context,
 			if !applies {
 				continue
 			}
+			sourceDescriber.binding = clusterRoleBinding
+			sourceDescriber.subject = &clusterRoleBinding.Subjects[subjectIndex]
 			role, rules, err := rr.GetRoleReferenceRules(ctx, clusterRoleBinding.RoleRef, host)
 			if err != nil {
-				if !visitor(nil, nil, nil, err) {
+				if !visitor(sourceDescriber, nil, nil, err) {
 					return
 				}
 				continue
 			}
-			sourceDescriber.binding = clusterRoleBinding
-			sourceDescriber.subject = &clusterRoleBinding.Subjects[subjectIndex]
 			for i := range rules {
 				if !visitor(sourceDescriber, role, &rules[i], nil) {
 					return
@@ -204,9 +221,9 @@ func UnionAllAuthorizers(ctx context.Context, cfg *authz.Config, kubeClient kube
 	nonResourceWithServiceRBACAuthorizor := newNonResourceWithServiceRBACAuthorizor(informerFactory)
 
 	authorizer := unionAuthzHandler{
-		wrapAuthorizer{staticAuthorizer},
+		wrapAuthorizer{staticAuthorizer, "static"},
 		nonResourceWithServiceRBACAuthorizor,
-		wrapAuthorizer{sarAuthorizer},
+		wrapAuthorizer{sarAuthorizer, "sar"},
 	}
 
 	return authorizer, nil
@@ -243,6 +260,12 @@ func (authzHandler unionAuthzHandler) Authorize(ctx context.Context, a authorize
 
 	for _, currAuthzHandler := range authzHandler {
 		service, decision, reason, err := currAuthzHandler.Authorize(ctx, a)
+		name := authorizerName(currAuthzHandler)
+		metrics.AuthorizationDecisions.WithLabelValues(name, decisionString(decision)).Inc()
+		trace.SpanFromContext(ctx).AddEvent("authorizer", trace.WithAttributes(
+			attribute.String("authorizer", name),
+			attribute.String("decision", decisionString(decision)),
+		))
 
 		if err != nil {
 			errlist = append(errlist, err)
@@ -261,8 +284,73 @@ func (authzHandler unionAuthzHandler) Authorize(ctx context.Context, a authorize
 	return "", authorizer.DecisionNoOpinion, strings.Join(reasonlist, "\n"), utilerrors.NewAggregate(errlist)
 }
 
+// explain authorizes as Authorize does, and traces the decision of every authorizer
+// until one decides.
+func (authzHandler unionAuthzHandler) explain(ctx context.Context, a authorizer.Attributes) *AuthorizationTrace {
+	trace := &AuthorizationTrace{
+		Verb:     a.GetVerb(),
+		Path:     a.GetPath(),
+		Provider: a.GetResource(),
+		Decision: decisionString(authorizer.DecisionNoOpinion),
+	}
+
+	var reasonlist []string
+	for _, currAuthzHandler := range authzHandler {
+		var (
+			service  string
+			decision authorizer.Decision
+			reason   string
+			err      error
+		)
+
+		name := authorizerName(currAuthzHandler)
+		switch t := currAuthzHandler.(type) {
+		case *nonResourceWithServiceRBACAuthorizor:
+			service, decision, reason, err = t.authorize(ctx, a, func(b BindingTrace) {
+				trace.Bindings = append(trace.Bindings, b)
+			})
+		default:
+			service, decision, reason, err = t.Authorize(ctx, a)
+		}
+
+		authzTrace := AuthorizerTrace{Name: name, Decision: decisionString(decision), Reason: reason}
+		if err != nil {
+			authzTrace.Error = err.Error()
+		}
+		trace.Authorizers = append(trace.Authorizers, authzTrace)
+
+		if decision == authorizer.DecisionAllow || decision == authorizer.DecisionDeny {
+			trace.Decision = authzTrace.Decision
+			trace.DecidedBy = name
+			trace.Reason = reason
+			trace.Service = service
+			return trace
+		}
+
+		if len(reason) != 0 {
+			reasonlist = append(reasonlist, reason)
+		}
+	}
+
+	trace.Reason = strings.Join(reasonlist, "\n")
+	return trace
+}
+
+// authorizerName returns the name of the authorizer in the traces and metrics.
+func authorizerName(a Authorizer) string {
+	switch t := a.(type) {
+	case wrapAuthorizer:
+		return t.name
+	case *nonResourceWithServiceRBACAuthorizor:
+		return "rbac"
+	}
+
+	return "unknown"
+}
+
 type wrapAuthorizer struct {
 	authorizer authorizer.Authorizer
+	name       string
 }
 
 func (t wrapAuthorizer) Authorize(ctx context.Context, a authorizer.Attributes) (service string, authorized authorizer.Decision, reason string, err error) {
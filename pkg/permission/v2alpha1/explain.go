@@ -0,0 +1,191 @@
+package v2alpha1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"bytetrade.io/web3os/system-server/pkg/constants"
+	permission "bytetrade.io/web3os/system-server/pkg/permission/v1alpha1"
+	"github.com/brancz/kube-rbac-proxy/pkg/authz"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apiserver/pkg/authentication/authenticator"
+	"k8s.io/apiserver/pkg/authentication/serviceaccount"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/klog/v2"
+)
+
+// Explainer explains the decisions of the data api and the rbac proxy, with the
+// same authenticator and authorizer of them.
+type Explainer struct {
+	authenticator authenticator.Request
+	authorizer    Authorizer
+	cfg           *authz.Config
+	ctrlSet       *permission.PermissionControlSet
+}
+
+func NewExplainer(authenticator authenticator.Request, authorizer Authorizer, cfg *authz.Config) *Explainer {
+	return &Explainer{authenticator: authenticator, authorizer: authorizer, cfg: cfg}
+}
+
+// WithAccessTokens explains the access tokens of the data api issued by ctrlSet.
+func (e *Explainer) WithAccessTokens(ctrlSet *permission.PermissionControlSet) *Explainer {
+	e.ctrlSet = ctrlSet
+	return e
+}
+
+func (e *Explainer) Explain(ctx context.Context, req *ExplainRequest) (*ExplainResp, error) {
+	if req.AccessToken != "" {
+		return e.explainAccessToken(req)
+	}
+
+	return e.explainProviderCall(ctx, req)
+}
+
+func (e *Explainer) explainAccessToken(req *ExplainRequest) (*ExplainResp, error) {
+	if e.ctrlSet == nil {
+		return nil, errors.New("access tokens are not supported")
+	}
+
+	if req.DataType == "" || req.Group == "" || req.Version == "" || req.Op == "" {
+		return nil, errors.New("datatype, group, version and op are required with access token")
+	}
+
+	access := permission.ExplainAccessToken(req.AccessToken, req.Op, req.DataType, req.Version, req.Group, e.ctrlSet)
+	resp := &ExplainResp{
+		Decision: decisionString(authorizer.DecisionDeny),
+		Reason:   access.Reason,
+		Access:   access,
+	}
+	if access.Allowed {
+		resp.Decision = decisionString(authorizer.DecisionAllow)
+	}
+
+	return resp, nil
+}
+
+func (e *Explainer) explainProviderCall(ctx context.Context, req *ExplainRequest) (*ExplainResp, error) {
+	if req.Provider == "" {
+		return nil, errors.New("provider is required")
+	}
+
+	method := req.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	path := req.Path
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	// the call as it comes to the rbac proxy
+	r, err := http.NewRequestWithContext(ctx, method, "http://"+req.Provider+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &ExplainResp{Decision: decisionString(authorizer.DecisionNoOpinion)}
+	u, ok, err := e.user(r, req)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		resp.Reason = "unauthenticated"
+		return resp, nil
+	}
+	resp.User, resp.Groups = u.GetName(), u.GetGroups()
+
+	allAttrs := getRequestAttributes(e.cfg, u, r)
+	if len(allAttrs) == 0 {
+		return nil, errors.New("the request or configuration is malformed")
+	}
+
+	// all the attributes must be allowed, as in WithAuthorization
+	resp.Decision = decisionString(authorizer.DecisionAllow)
+	for _, attrs := range allAttrs {
+		trace := e.explainAttributes(ctx, attrs)
+		resp.Checks = append(resp.Checks, *trace)
+
+		if resp.Decision == decisionString(authorizer.DecisionAllow) && trace.Decision != resp.Decision {
+			resp.Decision = trace.Decision
+			resp.Reason = trace.Reason
+		}
+	}
+
+	return resp, nil
+}
+
+func (e *Explainer) explainAttributes(ctx context.Context, attrs authorizer.Attributes) *AuthorizationTrace {
+	if union, ok := e.authorizer.(unionAuthzHandler); ok {
+		return union.explain(ctx, attrs)
+	}
+
+	return unionAuthzHandler{e.authorizer}.explain(ctx, attrs)
+}
+
+// user returns the user of the token or service account, false if the token is
+// not authenticated.
+func (e *Explainer) user(r *http.Request, req *ExplainRequest) (user.Info, bool, error) {
+	switch {
+	case req.ServiceAccount != "":
+		namespace, name, ok := strings.Cut(req.ServiceAccount, "/")
+		if !ok || namespace == "" || name == "" {
+			return nil, false, fmt.Errorf("invalid service account %q, it must be namespace/name", req.ServiceAccount)
+		}
+
+		return &user.DefaultInfo{
+			Name:   serviceaccount.MakeUsername(namespace, name),
+			Groups: append(serviceaccount.MakeGroupNames(namespace), user.AllAuthenticated),
+		}, true, nil
+
+	case req.Token != "":
+		// as the lldap token of a user, or the bearer token of a service account
+		r.Header.Set(constants.AuthorizationTokenKey, req.Token)
+		r.Header.Set("Authorization", "Bearer "+req.Token)
+
+		res, ok, err := e.authenticator.AuthenticateRequest(r)
+		if err != nil {
+			klog.V(2).Info("explain: unable to authenticate the token, ", err)
+		}
+		if err != nil || !ok {
+			return nil, false, nil
+		}
+
+		return res.User, true, nil
+	}
+
+	return nil, false, errors.New("token or service account is required")
+}
+
+func newBindingTrace(source fmt.Stringer, role *rbacv1.ClusterRole, rule *rbacv1.PolicyRule, err error, allowed bool) BindingTrace {
+	trace := BindingTrace{Allowed: allowed}
+	if source != nil {
+		trace.Binding = source.String()
+	}
+	if role != nil {
+		trace.ClusterRole = role.Name
+	}
+	if rule != nil {
+		trace.Rule = rule.DeepCopy()
+	}
+	if err != nil {
+		trace.Error = err.Error()
+	}
+
+	return trace
+}
+
+func decisionString(decision authorizer.Decision) string {
+	switch decision {
+	case authorizer.DecisionAllow:
+		return "allow"
+	case authorizer.DecisionDeny:
+		return "deny"
+	default:
+		return "no-opinion"
+	}
+}
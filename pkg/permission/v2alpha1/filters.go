@@ -1,6 +1,7 @@
 package v2alpha1
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -8,9 +9,12 @@ import (
 	apiv1alpha1 "bytetrade.io/web3os/system-server/pkg/apiserver/v1alpha1/api"
 	"bytetrade.io/web3os/system-server/pkg/constants"
 	providerv2alpha1 "bytetrade.io/web3os/system-server/pkg/providerregistry/v2alpha1"
+	"bytetrade.io/web3os/system-server/pkg/tracing"
 	"bytetrade.io/web3os/system-server/pkg/utils"
 	"github.com/brancz/kube-rbac-proxy/pkg/authz"
 	"github.com/brancz/kube-rbac-proxy/pkg/proxy"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"k8s.io/apiserver/pkg/authentication/authenticator"
 	"k8s.io/apiserver/pkg/authentication/user"
 	"k8s.io/apiserver/pkg/authorization/authorizer"
@@ -32,14 +36,21 @@ func WithAuthentication(
 			req = req.WithContext(ctx)
 		}
 
-		res, ok, err := authReq.AuthenticateRequest(req)
+		spanCtx, span := tracing.Start(ctx, "authenticate")
+		res, ok, err := authReq.AuthenticateRequest(req.WithContext(spanCtx))
+		span.SetAttributes(attribute.Bool("authenticated", ok))
+		if ok {
+			span.SetAttributes(attribute.String("user", res.User.GetName()))
+		}
+		tracing.End(span, err)
+
 		if err != nil {
 			klog.Errorf("Unable to authenticate the request due to an error: %v", err)
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			httpError(w, req, apiv1alpha1.ReasonUnauthorized, "Unauthorized")
 			return
 		}
 		if !ok {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			httpError(w, req, apiv1alpha1.ReasonUnauthorized, "Unauthorized")
 			return
 		}
 
@@ -53,82 +64,42 @@ func WithAuthorization(
 	cfg *authz.Config,
 	handler http.HandlerFunc,
 ) http.HandlerFunc {
-	getRequestAttributes := func(u user.Info, r *http.Request) []authorizer.Attributes {
-		allAttrs := proxy.
-			NewKubeRBACProxyAuthorizerAttributesGetter(cfg).
-			GetRequestAttributes(u, r)
-
-		for i, attrs := range allAttrs {
-			if attrs.GetPath() != "" && !attrs.IsResourceRequest() {
-				// for non-resource requests, setup the provider reference
-				uri := providerv2alpha1.GetXForwardedHost(r)
-				requestUrl, err := url.Parse(uri)
-				if err != nil {
-					klog.Errorf("failed to parse X-Forwarded-Host: %v", err)
-					return nil
-				}
-				hostStr := requestUrl.Host
-				if hostStr == "" {
-					hostStr = r.Host
-				}
-				klog.V(5).Infof("RBAC: using provider host %q, url: %q", hostStr, uri)
-				ref := hostStr
-
-				path := attrs.GetPath()
-				queryString := r.URL.RawQuery
-				if queryString != "" {
-					path = fmt.Sprintf("%s?%s", path, queryString)
-				}
-				a := authorizer.AttributesRecord{
-					User:            attrs.GetUser(),
-					Verb:            attrs.GetVerb(),
-					Namespace:       attrs.GetNamespace(),
-					APIGroup:        attrs.GetAPIGroup(),
-					APIVersion:      attrs.GetAPIVersion(),
-					Resource:        ref,
-					Subresource:     attrs.GetSubresource(),
-					Name:            attrs.GetName(),
-					ResourceRequest: attrs.IsResourceRequest(),
-					Path:            path,
-				}
-				allAttrs[i] = a
-			}
-		}
-
-		return allAttrs
-	}
-
 	return func(w http.ResponseWriter, req *http.Request) {
 		u, ok := request.UserFrom(req.Context())
 		if !ok {
-			http.Error(w, "user not in context", http.StatusBadRequest)
+			httpError(w, req, apiv1alpha1.ReasonBadRequest, "user not in context")
 			return
 		}
 
 		// Get authorization attributes
-		allAttrs := getRequestAttributes(u, req)
+		allAttrs := getRequestAttributes(cfg, u, req)
 		if len(allAttrs) == 0 {
 			msg := "Bad Request. The request or configuration is malformed."
 			klog.V(2).Info(msg)
-			http.Error(w, msg, http.StatusBadRequest)
+			httpError(w, req, apiv1alpha1.ReasonBadRequest, msg)
 			return
 		}
 
+		ctx, span := tracing.Start(req.Context(), "authorize", trace.WithAttributes(attribute.String("user", u.GetName())))
+
 		var service string
 		for _, attrs := range allAttrs {
 			// Authorize
-			s, authorized, reason, err := authz.Authorize(req.Context(), attrs)
+			s, authorized, reason, err := authz.Authorize(ctx, attrs)
 			if err != nil {
 				msg := fmt.Sprintf("Authorization error (user=%s, verb=%s, resource=%s, subresource=%s)", u.GetName(), attrs.GetVerb(), attrs.GetResource(), attrs.GetSubresource())
 				klog.Errorf("%s: %s", msg, err)
-				http.Error(w, msg, http.StatusInternalServerError)
+				tracing.End(span, err)
+				httpError(w, req, apiv1alpha1.ReasonInternal, msg)
 				return
 			}
 			klog.V(5).Infof("Authorization result, %d, reason=%s", authorized, reason)
 			if authorized != authorizer.DecisionAllow {
 				msg := fmt.Sprintf("Forbidden (user=%s, verb=%s, resource=%s, subresource=%s)", u.GetName(), attrs.GetVerb(), attrs.GetResource(), attrs.GetSubresource())
 				klog.V(2).Infof("%s. Reason: %q.", msg, reason)
-				http.Error(w, msg, http.StatusForbidden)
+				span.SetAttributes(attribute.String("decision", decisionString(authorized)), attribute.String("reason", reason))
+				span.End()
+				httpError(w, req, apiv1alpha1.ReasonForbidden, msg)
 				return
 			}
 
@@ -137,6 +108,9 @@ func WithAuthorization(
 			}
 		}
 
+		span.SetAttributes(attribute.String("decision", decisionString(authorizer.DecisionAllow)), attribute.String("provider.service", service))
+		span.End()
+
 		if service != "" {
 			req = req.WithContext(WithProviderService(req.Context(), service))
 		}
@@ -145,6 +119,65 @@ func WithAuthorization(
 	}
 }
 
+// getRequestAttributes returns the attributes to authorize the request, the provider
+// host of the non-resource requests is in the resource.
+func getRequestAttributes(cfg *authz.Config, u user.Info, r *http.Request) []authorizer.Attributes {
+	allAttrs := proxy.
+		NewKubeRBACProxyAuthorizerAttributesGetter(cfg).
+		GetRequestAttributes(u, r)
+
+	for i, attrs := range allAttrs {
+		if attrs.GetPath() != "" && !attrs.IsResourceRequest() {
+			// for non-resource requests, setup the provider reference
+			uri := providerv2alpha1.GetXForwardedHost(r)
+			requestUrl, err := url.Parse(uri)
+			if err != nil {
+				klog.Errorf("failed to parse X-Forwarded-Host: %v", err)
+				return nil
+			}
+			hostStr := requestUrl.Host
+			if hostStr == "" {
+				hostStr = r.Host
+			}
+			klog.V(5).Infof("RBAC: using provider host %q, url: %q", hostStr, uri)
+			ref := hostStr
+
+			path := attrs.GetPath()
+			queryString := r.URL.RawQuery
+			if queryString != "" {
+				path = fmt.Sprintf("%s?%s", path, queryString)
+			}
+			a := authorizer.AttributesRecord{
+				User:            attrs.GetUser(),
+				Verb:            attrs.GetVerb(),
+				Namespace:       attrs.GetNamespace(),
+				APIGroup:        attrs.GetAPIGroup(),
+				APIVersion:      attrs.GetAPIVersion(),
+				Resource:        ref,
+				Subresource:     attrs.GetSubresource(),
+				Name:            attrs.GetName(),
+				ResourceRequest: attrs.IsResourceRequest(),
+				Path:            path,
+			}
+			allAttrs[i] = a
+		}
+	}
+
+	return allAttrs
+}
+
+// httpError writes the error of the filters, as problem details unless in the
+// compatibility mode.
+func httpError(w http.ResponseWriter, req *http.Request, reason apiv1alpha1.Reason, msg string) {
+	e := apiv1alpha1.NewError(reason, errors.New(msg))
+	if !apiv1alpha1.ProblemDetails() {
+		http.Error(w, msg, e.Status)
+		return
+	}
+
+	apiv1alpha1.WriteProblem(w, e, req.URL.Path)
+}
+
 func WithUserHeader(
 	convert func(account string) string,
 	handler http.HandlerFunc,
@@ -170,7 +203,7 @@ func MustHaveProviderService(
 	return func(w http.ResponseWriter, req *http.Request) {
 		_, ok := ProviderServiceFrom(req.Context())
 		if !ok {
-			http.Error(w, "provider service not found", http.StatusBadRequest)
+			httpError(w, req, apiv1alpha1.ReasonBadRequest, "provider service not found")
 			return
 		}
 
@@ -3,6 +3,7 @@ package v2alpha1
 import (
 	"context"
 	"errors"
+	"fmt"
 
 	"bytetrade.io/web3os/system-server/pkg/apiserver/v1alpha1/api"
 	"bytetrade.io/web3os/system-server/pkg/apiserver/v1alpha1/api/response"
@@ -17,6 +18,7 @@ import (
 type handler struct {
 	*apitools.BaseHandler
 	kubeClient kubernetes.Interface
+	explainer  *Explainer
 }
 
 func (h *handler) register(req *restful.Request, resp *restful.Response) {
@@ -47,6 +49,34 @@ func (h *handler) unregister(req *restful.Request, resp *restful.Response) {
 	response.SuccessNoData(resp)
 }
 
+func (h *handler) explain(req *restful.Request, resp *restful.Response) {
+	ok, username := h.Validate(req, resp)
+	if !ok {
+		return
+	}
+
+	// the apps of the owner are not allowed to look into the permissions
+	if account, _ := h.GetUser(req); account != username {
+		api.HandleForbidden(resp, req, fmt.Errorf("only the owner can explain permissions, %s", account))
+		return
+	}
+
+	var explainReq ExplainRequest
+	if err := req.ReadEntity(&explainReq); err != nil {
+		api.HandleBadRequest(resp, req, err)
+		return
+	}
+
+	explainResp, err := h.explainer.Explain(req.Request.Context(), &explainReq)
+	if err != nil {
+		api.HandleBadRequest(resp, req, err)
+		return
+	}
+
+	klog.Info("explain permission for ", username, ", decision=", explainResp.Decision)
+	response.Success(resp, explainResp)
+}
+
 func (h *handler) execute(req *restful.Request, resp *restful.Response, username string,
 	action func(ctx context.Context, user, app, serviceAccount string, roles []*rbacv1.ClusterRole) error) (success bool, appName string) {
 	var err error
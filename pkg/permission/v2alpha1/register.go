@@ -20,9 +20,10 @@ func AddPermissionControlToContainer(
 	c *restful.Container,
 	requireAuth func(f restful.RouteFunction) restful.RouteFunction,
 	kubeconfig *rest.Config,
+	explainer *Explainer,
 ) error {
 	client := kubernetes.NewForConfigOrDie(kubeconfig)
-	handler := &handler{BaseHandler: &apitools.BaseHandler{}, kubeClient: client}
+	handler := &handler{BaseHandler: &apitools.BaseHandler{}, kubeClient: client, explainer: explainer}
 	ws := newWebService()
 
 	ws.Route(ws.POST("/register").
@@ -37,6 +38,15 @@ func AddPermissionControlToContainer(
 		Metadata(restfulspec.KeyOpenAPITags, MODULE_TAGS).
 		Returns(http.StatusOK, "Success to unregister a invoker", &response.Response{}))
 
+	if explainer != nil {
+		ws.Route(ws.POST("/explain").
+			To(requireAuth(handler.explain)).
+			Doc("explain the authorization decision of a data api call or a provider call").
+			Metadata(restfulspec.KeyOpenAPITags, MODULE_TAGS).
+			Reads(ExplainRequest{}).
+			Returns(http.StatusOK, "Success to explain the decision", &ExplainResp{}))
+	}
+
 	c.Add(ws)
 
 	return nil
@@ -1,5 +1,11 @@
 package v2alpha1
 
+import (
+	permission "bytetrade.io/web3os/system-server/pkg/permission/v1alpha1"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
 type RegisterResp struct {
 }
 
@@ -16,3 +22,70 @@ type PermissionRegister struct {
 	AppID string              `json:"appid"`
 	Perm  []PermissionRequire `json:"perm"`
 }
+
+// ExplainRequest is a call to explain, either a data api call with the access
+// token of an app, or a provider call of a user or service account.
+type ExplainRequest struct {
+	// the data api call
+	AccessToken string `json:"access_token,omitempty"`
+	DataType    string `json:"datatype,omitempty"`
+	Group       string `json:"group,omitempty"`
+	Version     string `json:"version,omitempty"`
+	Op          string `json:"op,omitempty"`
+
+	// the provider call, of the user of token or the service account in the
+	// form of namespace/name
+	Token          string `json:"token,omitempty"`
+	ServiceAccount string `json:"service_account,omitempty"`
+	Provider       string `json:"provider,omitempty"`
+	Path           string `json:"path,omitempty"`
+	// GET if it's empty
+	Method string `json:"method,omitempty"`
+}
+
+type ExplainResp struct {
+	// allow, deny or no-opinion
+	Decision string `json:"decision"`
+	Reason   string `json:"reason,omitempty"`
+
+	// the trace of the data api call
+	Access *permission.AccessExplanation `json:"access,omitempty"`
+
+	// the trace of the provider call, for every authorization attributes of it
+	User   string               `json:"user,omitempty"`
+	Groups []string             `json:"groups,omitempty"`
+	Checks []AuthorizationTrace `json:"checks,omitempty"`
+}
+
+type AuthorizationTrace struct {
+	Verb     string `json:"verb"`
+	Path     string `json:"path"`
+	Provider string `json:"provider"`
+
+	Decision  string `json:"decision"`
+	DecidedBy string `json:"decided_by,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+	Service   string `json:"service,omitempty"`
+
+	// the authorizers in order, until one decides
+	Authorizers []AuthorizerTrace `json:"authorizers"`
+	// the rules of the ClusterRoleBindings of the user visited by rbac
+	Bindings []BindingTrace `json:"bindings,omitempty"`
+}
+
+type AuthorizerTrace struct {
+	Name     string `json:"name"`
+	Decision string `json:"decision"`
+	Reason   string `json:"reason,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+type BindingTrace struct {
+	// empty if the bindings can't be listed
+	Binding     string             `json:"binding,omitempty"`
+	ClusterRole string             `json:"cluster_role,omitempty"`
+	Rule        *rbacv1.PolicyRule `json:"rule,omitempty"`
+	Allowed     bool               `json:"allowed"`
+	// e.g. the cluster role does not match the provider
+	Error string `json:"error,omitempty"`
+}
@@ -0,0 +1,213 @@
+package pki
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	certutil "k8s.io/client-go/util/cert"
+	"k8s.io/client-go/util/keyutil"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// CASecretName is the Secret in the namespace of system-server keeping the CA.
+	CASecretName = "system-server-ca"
+
+	// CACertKey is the key of the CA certificate in the Secrets issued to the providers.
+	CACertKey = "ca.crt"
+
+	// the CA lives 10 years, the certificates issued by it are short-lived
+	caCommonName = "system-server-ca"
+)
+
+// CA is the internal certificate authority of system-server.
+type CA struct {
+	cert    *x509.Certificate
+	key     crypto.Signer
+	certPEM []byte
+	pool    *x509.CertPool
+}
+
+// LoadOrCreateCA loads the CA from the Secret in namespace, it's created at the
+// first start.
+func LoadOrCreateCA(ctx context.Context, client kubernetes.Interface, namespace string) (*CA, error) {
+	secret, err := client.CoreV1().Secrets(namespace).Get(ctx, CASecretName, metav1.GetOptions{})
+	if err == nil {
+		return parseCA(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey])
+	}
+	if !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+
+	certPEM, keyPEM, err := newCA()
+	if err != nil {
+		return nil, err
+	}
+
+	secret = &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      CASecretName,
+			Namespace: namespace,
+			Labels:    map[string]string{ManagedByLabel: ManagedBy},
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       certPEM,
+			corev1.TLSPrivateKeyKey: keyPEM,
+		},
+	}
+
+	_, err = client.CoreV1().Secrets(namespace).Create(ctx, secret, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		// created by another replica, use that one
+		return LoadOrCreateCA(ctx, client, namespace)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	klog.Info("created the internal CA of system-server in ", namespace)
+	return parseCA(certPEM, keyPEM)
+}
+
+func newCA() (certPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cert, err := certutil.NewSelfSignedCACert(certutil.Config{CommonName: caCommonName}, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyPEM, err = keyutil.MarshalPrivateKeyToPEM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return encodeCert(cert.Raw), keyPEM, nil
+}
+
+func parseCA(certPEM, keyPEM []byte) (*CA, error) {
+	certs, err := certutil.ParseCertsPEM(certPEM)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CA certificate, %w", err)
+	}
+
+	key, err := keyutil.ParsePrivateKeyPEM(keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CA key, %w", err)
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("invalid CA key, not a signer")
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(certs[0])
+
+	return &CA{cert: certs[0], key: signer, certPEM: certPEM, pool: pool}, nil
+}
+
+// CertPEM returns the certificate of the CA in PEM.
+func (ca *CA) CertPEM() []byte {
+	return ca.certPEM
+}
+
+// Pool returns the pool trusting the CA only.
+func (ca *CA) Pool() *x509.CertPool {
+	return ca.pool
+}
+
+// Issue issues a certificate for usages, valid for ttl.
+func (ca *CA) Issue(commonName string, dnsNames []string, ttl time.Duration, usages ...x509.ExtKeyUsage) (certPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).SetInt64(math.MaxInt64))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// tolerate the clock skew between the nodes
+	now := time.Now().Add(-5 * time.Minute)
+	notAfter := time.Now().Add(ttl)
+	if notAfter.After(ca.cert.NotAfter) {
+		notAfter = ca.cert.NotAfter
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     dnsNames,
+		NotBefore:    now,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  usages,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, key.Public(), ca.key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyPEM, err = keyutil.MarshalPrivateKeyToPEM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return encodeCert(der), keyPEM, nil
+}
+
+// verify returns the certificate if it's issued by the CA for all of dnsNames and
+// exactly the usages.
+func (ca *CA) verify(certPEM []byte, dnsNames []string, usages ...x509.ExtKeyUsage) (*x509.Certificate, error) {
+	certs, err := certutil.ParseCertsPEM(certPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := x509.VerifyOptions{
+		Roots:     ca.pool,
+		KeyUsages: usages,
+	}
+	if _, err := certs[0].Verify(opts); err != nil {
+		return nil, err
+	}
+
+	// a certificate with more usages than asked is reissued, e.g. for client auth
+	if len(certs[0].ExtKeyUsage) != len(usages) {
+		return nil, fmt.Errorf("certificate %s has unexpected key usages", certs[0].Subject.CommonName)
+	}
+
+	for _, name := range dnsNames {
+		if err := certs[0].VerifyHostname(name); err != nil {
+			return nil, err
+		}
+	}
+
+	return certs[0], nil
+}
+
+func encodeCert(der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: certutil.CertificateBlockType, Bytes: der})
+}
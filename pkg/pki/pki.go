@@ -0,0 +1,318 @@
+package pki
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"bytetrade.io/web3os/system-server/pkg/constants"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+const (
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	ManagedBy      = "system-server"
+
+	// ProviderSecretSuffix is the suffix of the Secrets issued to the provider
+	// services, <service>-mtls in the namespace of the service. The certificates
+	// in them are for server auth only, the providers verifying the client
+	// certificates must pin the CN/SAN system-server, as only the certificate of
+	// system-server itself is for client auth.
+	ProviderSecretSuffix = "-mtls"
+
+	// ServiceLabel is the provider service of the Secrets issued to the providers.
+	ServiceLabel = "sys.bytetrade.io/mtls-service"
+
+	DefaultCertTTL = 24 * time.Hour
+)
+
+var (
+	// the default CA, nil if mTLS is disabled
+	defaultCA     *CA
+	defaultClient kubernetes.Interface
+
+	// the certificate of system-server itself
+	self *keyPair
+
+	rootCAs *x509.CertPool
+
+	// the usages of the certificates issued to the providers, and of system-server
+	// calling them
+	providerUsages = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	selfUsages     = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+)
+
+// Init loads the CA and issues the certificate of system-server, the upstream
+// calls to the providers are mTLS once it's done.
+func Init(ctx context.Context, client kubernetes.Interface, namespace string) error {
+	ca, err := LoadOrCreateCA(ctx, client, namespace)
+	if err != nil {
+		return fmt.Errorf("load CA error, %w", err)
+	}
+
+	// the providers with public certificates are still trusted
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	pool.AppendCertsFromPEM(ca.CertPEM())
+
+	name := constants.ProxyServerServiceName
+	self = &keyPair{ca: ca, commonName: name, dnsNames: dnsNames(name, namespace), usages: selfUsages}
+	if _, err := self.get(); err != nil {
+		return fmt.Errorf("issue certificate error, %w", err)
+	}
+
+	defaultCA, defaultClient, rootCAs = ca, client, pool
+
+	// the secrets are checked a few times in the renewal window
+	period := certTTL() / 6
+	if period < time.Minute {
+		period = time.Minute
+	}
+	go wait.UntilWithContext(ctx, renewSecrets, period)
+	return nil
+}
+
+// Enabled returns whether the upstream calls are mTLS.
+func Enabled() bool {
+	return defaultCA != nil
+}
+
+// Scheme returns the scheme of the provider endpoints without one.
+func Scheme() string {
+	if Enabled() {
+		return "https"
+	}
+
+	return "http"
+}
+
+// ClientTLSConfig returns the tls config of the upstream calls presenting the
+// certificate of system-server, nil if mTLS is disabled.
+func ClientTLSConfig() *tls.Config {
+	if !Enabled() {
+		return nil
+	}
+
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		RootCAs:    rootCAs,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return self.get()
+		},
+	}
+}
+
+// ServerTLSConfig returns the tls config of system-server, the client certificates
+// issued by the CA are verified if given, nil if mTLS is disabled.
+func ServerTLSConfig() *tls.Config {
+	if !Enabled() {
+		return nil
+	}
+
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ClientCAs:  defaultCA.Pool(),
+		ClientAuth: tls.VerifyClientCertIfGiven,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return self.get()
+		},
+	}
+}
+
+// EnsureProviderSecret issues the certificate of the provider service in endpoint
+// to the Secret <service>-mtls, if it's missing or expiring.
+func EnsureProviderSecret(ctx context.Context, endpoint, namespace string) error {
+	if !Enabled() {
+		return nil
+	}
+
+	service, svcNamespace, err := parseService(endpoint, namespace)
+	if err != nil {
+		return err
+	}
+
+	return ensureSecret(ctx, service, svcNamespace)
+}
+
+// renewSecrets renews all the expiring Secrets issued to the providers.
+func renewSecrets(ctx context.Context) {
+	secrets, err := defaultClient.CoreV1().Secrets(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		LabelSelector: ServiceLabel,
+	})
+	if err != nil {
+		klog.Error("list provider secrets error, ", err)
+		return
+	}
+
+	for _, secret := range secrets.Items {
+		if secret.Labels[ManagedByLabel] != ManagedBy {
+			continue
+		}
+
+		if err := ensureSecret(ctx, secret.Labels[ServiceLabel], secret.Namespace); err != nil {
+			klog.Error("renew secret ", secret.Namespace, "/", secret.Name, " error, ", err)
+		}
+	}
+}
+
+func ensureSecret(ctx context.Context, service, namespace string) error {
+	names := dnsNames(service, namespace)
+	secrets := defaultClient.CoreV1().Secrets(namespace)
+	secretName := service + ProviderSecretSuffix
+
+	secret, err := secrets.Get(ctx, secretName, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		secret = nil
+	case err != nil:
+		return err
+	case secret.Labels[ManagedByLabel] != ManagedBy:
+		return fmt.Errorf("secret %s/%s is not managed by system-server", namespace, secretName)
+	default:
+		cert, err := defaultCA.verify(secret.Data[corev1.TLSCertKey], names, providerUsages...)
+		if err == nil && time.Now().Before(renewAt(cert)) {
+			return nil
+		}
+	}
+
+	certPEM, keyPEM, err := defaultCA.Issue(service, names, certTTL(), providerUsages...)
+	if err != nil {
+		return err
+	}
+
+	data := map[string][]byte{
+		corev1.TLSCertKey:       certPEM,
+		corev1.TLSPrivateKeyKey: keyPEM,
+		CACertKey:               defaultCA.CertPEM(),
+	}
+
+	if secret == nil {
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      secretName,
+				Namespace: namespace,
+				Labels: map[string]string{
+					ManagedByLabel: ManagedBy,
+					ServiceLabel:   service,
+				},
+			},
+			Type: corev1.SecretTypeTLS,
+			Data: data,
+		}
+		_, err = secrets.Create(ctx, secret, metav1.CreateOptions{})
+	} else {
+		secret = secret.DeepCopy()
+		secret.Data = data
+		_, err = secrets.Update(ctx, secret, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return err
+	}
+
+	klog.Info("issued the certificate of provider service ", service, " to ", namespace, "/", secretName)
+	return nil
+}
+
+// keyPair is a certificate renewed before it expires.
+type keyPair struct {
+	ca         *CA
+	commonName string
+	dnsNames   []string
+	usages     []x509.ExtKeyUsage
+
+	mu   sync.Mutex
+	cert *tls.Certificate
+}
+
+func (k *keyPair) get() (*tls.Certificate, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.cert != nil && time.Now().Before(renewAt(k.cert.Leaf)) {
+		return k.cert, nil
+	}
+
+	certPEM, keyPEM, err := k.ca.Issue(k.commonName, k.dnsNames, certTTL(), k.usages...)
+	if err != nil {
+		if k.cert != nil && time.Now().Before(k.cert.Leaf.NotAfter) {
+			// keep the current one until it expires
+			klog.Error("renew certificate error, ", err)
+			return k.cert, nil
+		}
+		return nil, err
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	k.cert = &cert
+	return k.cert, nil
+}
+
+// renewAt returns the time after 2/3 of the lifetime of cert.
+func renewAt(cert *x509.Certificate) time.Time {
+	return cert.NotBefore.Add(cert.NotAfter.Sub(cert.NotBefore) * 2 / 3)
+}
+
+func certTTL() time.Duration {
+	if constants.MTLSCertTTL > 0 {
+		return constants.MTLSCertTTL
+	}
+
+	return DefaultCertTTL
+}
+
+// parseService returns the service and namespace of the endpoint, e.g.
+// http://svc.ns:8080/path, the namespace is the default if it's not in endpoint.
+func parseService(endpoint, namespace string) (service, svcNamespace string, err error) {
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "http://" + endpoint
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", "", err
+	}
+
+	host := u.Hostname()
+	if host == "" || net.ParseIP(host) != nil {
+		return "", "", errors.New("the endpoint must be a service name, " + endpoint)
+	}
+
+	labels := strings.Split(host, ".")
+	if len(labels) > 1 {
+		namespace = labels[1]
+	}
+	if namespace == "" {
+		return "", "", errors.New("unknown namespace of the endpoint, " + endpoint)
+	}
+
+	return labels[0], namespace, nil
+}
+
+// dnsNames returns all the names of the service in the cluster.
+func dnsNames(service, namespace string) []string {
+	return []string{
+		service,
+		service + "." + namespace,
+		service + "." + namespace + ".svc",
+		service + "." + namespace + ".svc.cluster.local",
+	}
+}
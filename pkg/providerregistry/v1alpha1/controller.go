@@ -1,6 +1,7 @@
 package prodiverregistry
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"time"
@@ -9,7 +10,9 @@ import (
 	"bytetrade.io/web3os/system-server/pkg/generated/clientset/versioned/scheme"
 	informers "bytetrade.io/web3os/system-server/pkg/generated/informers/externalversions/sys/v1alpha1"
 	listers "bytetrade.io/web3os/system-server/pkg/generated/listers/sys/v1alpha1"
+	"bytetrade.io/web3os/system-server/pkg/pki"
 
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/tools/cache"
@@ -144,12 +147,12 @@ func (c *Controller) processNextWorkItem() bool {
 		//
 
 		// Run the syncHandler, passing it the namespace/name string of the
-		// Foo resource to be synced.
-		// if err := c.syncHandler(key); err != nil {
-		// 	// Put the item back on the workqueue to handle any transient errors.
-		// 	c.workqueue.AddRateLimited(key)
-		// 	return fmt.Errorf("error syncing '%s': %s, requeuing", key, err.Error())
-		// }
+		// ProviderRegistry resource to be synced.
+		if err := c.syncHandler(key); err != nil {
+			// Put the item back on the workqueue to handle any transient errors.
+			c.workqueue.AddRateLimited(key)
+			return fmt.Errorf("error syncing '%s': %s, requeuing", key, err.Error())
+		}
 		// Finally, if no error occurs we Forget this item so it does not
 		// get queued again until another change happens.
 		c.workqueue.Forget(obj)
@@ -165,6 +168,41 @@ func (c *Controller) processNextWorkItem() bool {
 	return true
 }
 
+// syncHandler issues the certificate of the provider service if mTLS is enabled,
+// it's renewed by the pki.
+func (c *Controller) syncHandler(key string) error {
+	if !pki.Enabled() {
+		return nil
+	}
+
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		utilruntime.HandleError(fmt.Errorf("invalid resource key: %s", key))
+		return nil
+	}
+
+	provider, err := c.providerLister.ProviderRegistries(namespace).Get(name)
+	if err != nil {
+		// the secret is kept after the provider is deleted, it may be shared
+		// by the other providers of the service
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	if provider.Spec.Endpoint == "" {
+		return nil
+	}
+
+	providerNamespace := provider.Spec.Namespace
+	if providerNamespace == "" {
+		providerNamespace = provider.Namespace
+	}
+
+	return pki.EnsureProviderSecret(context.TODO(), provider.Spec.Endpoint, providerNamespace)
+}
+
 func diff(old interface{}, new interface{}) (bool, error) {
 	olddata, err := json.Marshal(old)
 	if err != nil {
@@ -14,6 +14,8 @@ import (
 	"k8s.io/klog/v2"
 )
 
+// ErrProviderNotFound is returned if there's no active provider or watcher, it's
+// not_found in the apis.
 var ErrProviderNotFound = errors.New("provider not found")
 
 type Registry struct {
@@ -23,10 +25,15 @@ type Registry struct {
 }
 
 func NewRegistry(clientset clientset.Interface, lister v1alpha1.ProviderRegistryLister) *Registry {
+	return NewRegistryInNamespace(clientset, lister, constants.MyNamespace)
+}
+
+// NewRegistryInNamespace returns the registry of the providers in namespace.
+func NewRegistryInNamespace(clientset clientset.Interface, lister v1alpha1.ProviderRegistryLister, namespace string) *Registry {
 	registry := &Registry{
 		registryClientset: clientset,
 		registryLister:    lister,
-		namespace:         constants.MyNamespace,
+		namespace:         namespace,
 	}
 
 	return registry
@@ -58,6 +65,38 @@ func (r *Registry) GetProvider(_ context.Context, dataType, group, version strin
 	return nil, ErrProviderNotFound
 }
 
+// ListProviders returns all active providers, it's the catalogue of data types.
+func (r *Registry) ListProviders(_ context.Context) ([]*sysv1alpha1.ProviderRegistry, error) {
+	providerRegistries, err := r.registryLister.
+		ProviderRegistries(r.namespace).
+		List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+
+	prs := make([]*sysv1alpha1.ProviderRegistry, 0, len(providerRegistries))
+	for _, pr := range providerRegistries {
+		if pr.Status.State == sysv1alpha1.Active && pr.Spec.Kind == sysv1alpha1.Provider {
+			prs = append(prs, pr.DeepCopy())
+		}
+	}
+
+	return prs, nil
+}
+
+func (r *Registry) GetWatcher(_ context.Context, name string) (*sysv1alpha1.ProviderRegistry, error) {
+	pr, err := r.registryLister.ProviderRegistries(r.namespace).Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if pr.Spec.Kind != sysv1alpha1.Watcher {
+		return nil, ErrProviderNotFound
+	}
+
+	return pr, nil
+}
+
 func (r *Registry) GetWatchers(ctx context.Context, dataType, group, version string) ([]*sysv1alpha1.ProviderRegistry, error) {
 	providerRegistries, err := r.registryLister.
 		ProviderRegistries(r.namespace).
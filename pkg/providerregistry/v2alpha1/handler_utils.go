@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"bytetrade.io/web3os/system-server/pkg/constants"
+	"bytetrade.io/web3os/system-server/pkg/pki"
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -34,6 +35,13 @@ func (h *handler) createRefForProvider(ctx context.Context, appName, appNamespac
 	err = h.createServiceForProviderProxy(ctx, appName, provider.Service)
 	if err != nil {
 		klog.Error("create service for provider proxy err,", err)
+		return err
+	}
+
+	// issue the certificate of the provider service if mTLS is enabled
+	err = pki.EnsureProviderSecret(ctx, provider.Service, appNamespace)
+	if err != nil {
+		klog.Error("issue certificate for provider err,", err)
 	}
 	return err
 }
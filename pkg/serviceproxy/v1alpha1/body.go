@@ -0,0 +1,77 @@
+package serviceproxy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	sysv1alpha1 "bytetrade.io/web3os/system-server/pkg/apis/sys/v1alpha1"
+	"bytetrade.io/web3os/system-server/pkg/constants"
+
+	"github.com/emicklei/go-restful/v3"
+	"github.com/go-resty/resty/v2"
+)
+
+// LegacyUploadTimeout is the timeout of the legacy requests with body, the uploads
+// are streamed to the provider, so they take as long as the client sends.
+const LegacyUploadTimeout = time.Hour
+
+var ErrRequestBodyTooLarge = errors.New("request body too large")
+
+// maxRequestBodySize returns the body size limit of provider, 0 for unlimited.
+func maxRequestBodySize(provider *sysv1alpha1.ProviderRegistry) int64 {
+	if provider.Spec.MaxRequestBodySize > 0 {
+		return provider.Spec.MaxRequestBodySize
+	}
+
+	return constants.MaxRequestBodySize
+}
+
+// hasRequestBody returns whether the incoming request has a body, with a known
+// length or chunked.
+func hasRequestBody(req *restful.Request) bool {
+	return req.Request.Body != nil && req.Request.Body != http.NoBody && req.Request.ContentLength != 0
+}
+
+// setRequestBody streams the body of the incoming request to the provider instead
+// of buffering it, chunked and multipart bodies are passed as is. The length of the
+// body is kept, so the provider gets the same Content-Length as the client sent.
+func setRequestBody(client *resty.Client, proxyReq *resty.Request,
+	req *restful.Request, resp *restful.Response, limit int64) error {
+	if !hasRequestBody(req) {
+		return nil
+	}
+
+	length := req.Request.ContentLength
+	if limit > 0 && length > limit {
+		return fmt.Errorf("%w, %d bytes exceeds the limit %d", ErrRequestBodyTooLarge, length, limit)
+	}
+
+	body := req.Request.Body
+	if limit > 0 {
+		body = http.MaxBytesReader(resp.ResponseWriter, body, limit)
+	}
+
+	// resty never sets the length of a reader body unless it buffers it
+	client.SetPreRequestHook(func(_ *resty.Client, r *http.Request) error {
+		if length > 0 {
+			r.ContentLength = length
+		}
+		return nil
+	})
+	proxyReq.SetBody(body)
+
+	return nil
+}
+
+// requestBodyError returns ErrRequestBodyTooLarge if the streamed body exceeds the
+// limit, or err as is.
+func requestBodyError(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return fmt.Errorf("%w, exceeds the limit %d", ErrRequestBodyTooLarge, maxBytesErr.Limit)
+	}
+
+	return err
+}
@@ -0,0 +1,159 @@
+package serviceproxy
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+// DefaultCacheMaxEntries is the max number of responses kept by the cache.
+const DefaultCacheMaxEntries = 10000
+
+type cacheEntry struct {
+	value   map[string]interface{}
+	expires time.Time
+}
+
+// ResponseCache caches the Get and List responses of providers declaring a cache
+// TTL on the op. The responses of a data type are invalidated by its mutations
+// flowing through the dispatcher.
+type ResponseCache struct {
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[string]map[string]*cacheEntry // data type key -> request key -> entry
+	size    int
+	// generations are bumped by the invalidations, so that a response fetched
+	// before a mutation is never cached after it.
+	generations map[string]uint64
+}
+
+func NewResponseCache(ctx context.Context, maxEntries int) *ResponseCache {
+	if maxEntries <= 0 {
+		maxEntries = DefaultCacheMaxEntries
+	}
+
+	c := &ResponseCache{
+		maxEntries:  maxEntries,
+		entries:     make(map[string]map[string]*cacheEntry),
+		generations: make(map[string]uint64),
+	}
+
+	go wait.Until(c.purge, time.Minute, ctx.Done())
+
+	return c
+}
+
+func dataTypeKey(dataType, group, version string) string {
+	return strings.Join([]string{dataType, group, version}, "/")
+}
+
+// requestKey returns the key of request in the scope of the app, with the op and params.
+func requestKey(op string, req *ProxyRequest) (string, error) {
+	param, err := json.Marshal(req.Param)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Join([]string{req.AppKey, op, string(param)}, "|"), nil
+}
+
+// Get returns the cached response of request and the current generation of its data
+// type, the generation is required by Set.
+func (c *ResponseCache) Get(op string, req *ProxyRequest) (map[string]interface{}, uint64, bool) {
+	dtKey := dataTypeKey(req.DataType, req.Group, req.Version)
+	key, err := requestKey(op, req)
+	if err != nil {
+		return nil, 0, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	gen := c.generations[dtKey]
+	entry, ok := c.entries[dtKey][key]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, gen, false
+	}
+
+	return entry.value, gen, true
+}
+
+// Set caches the response of request, if the data type hasn't been mutated since
+// the generation returned by Get.
+func (c *ResponseCache) Set(op string, req *ProxyRequest, gen uint64, value map[string]interface{}, ttl time.Duration) {
+	dtKey := dataTypeKey(req.DataType, req.Group, req.Version)
+	key, err := requestKey(op, req)
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.generations[dtKey] != gen {
+		return
+	}
+
+	if c.size >= c.maxEntries {
+		c.purgeLocked()
+		if c.size >= c.maxEntries {
+			klog.V(4).Info("response cache is full, skip caching")
+			return
+		}
+	}
+
+	entries, ok := c.entries[dtKey]
+	if !ok {
+		entries = make(map[string]*cacheEntry)
+		c.entries[dtKey] = entries
+	}
+
+	if _, ok := entries[key]; !ok {
+		c.size++
+	}
+	entries[key] = &cacheEntry{value: value, expires: time.Now().Add(ttl)}
+}
+
+// Invalidate drops the cached responses of the data type.
+func (c *ResponseCache) Invalidate(dataType, group, version string) {
+	dtKey := dataTypeKey(dataType, group, version)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generations[dtKey]++
+	if entries, ok := c.entries[dtKey]; ok {
+		c.size -= len(entries)
+		delete(c.entries, dtKey)
+		klog.V(4).Info("response cache invalidated, ", dtKey, ", ", len(entries))
+	}
+}
+
+func (c *ResponseCache) purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.purgeLocked()
+}
+
+func (c *ResponseCache) purgeLocked() {
+	now := time.Now()
+	for dtKey, entries := range c.entries {
+		for key, entry := range entries {
+			if now.After(entry.expires) {
+				delete(entries, key)
+				c.size--
+			}
+		}
+
+		if len(entries) == 0 {
+			delete(c.entries, dtKey)
+		}
+	}
+}
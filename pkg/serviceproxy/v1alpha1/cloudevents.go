@@ -0,0 +1,147 @@
+package serviceproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	sysv1alpha1 "bytetrade.io/web3os/system-server/pkg/apis/sys/v1alpha1"
+
+	"github.com/emicklei/go-restful/v3"
+)
+
+const (
+	CloudEventsSpecVersion = "1.0"
+	CloudEventsContentType = "application/cloudevents+json"
+
+	// CloudEventTypePrefix prefixes the type of events, followed by the data type and op,
+	// e.g. io.bytetrade.sys.calendar.create
+	CloudEventTypePrefix = "io.bytetrade.sys."
+
+	cloudEventHeaderPrefix = "ce-"
+)
+
+// CloudEvent is a dispatched request in CloudEvents 1.0 format.
+type CloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            time.Time       `json:"time"`
+	DataContentType string          `json:"datacontenttype"`
+	Data            json.RawMessage `json:"data"`
+
+	// Cursor is an extension attribute, the position of the event in the event log.
+	Cursor int64 `json:"cursor,omitempty"`
+}
+
+// CloudEventData is the data of a CloudEvent, the dispatch request without the
+// caller's token.
+type CloudEventData struct {
+	Op       string      `json:"op"`
+	DataType string      `json:"datatype"`
+	Version  string      `json:"version"`
+	Group    string      `json:"group"`
+	AppKey   string      `json:"appkey"`
+	Param    interface{} `json:"param,omitempty"`
+	Data     interface{} `json:"data,omitempty"`
+	Result   interface{} `json:"result"`
+}
+
+// IsCloudEvents returns whether the format is one of CloudEvents formats.
+func IsCloudEvents(format string) bool {
+	return format == sysv1alpha1.FormatCloudEvents || format == sysv1alpha1.FormatCloudEventsBinary
+}
+
+// ValidFormat returns whether the format of events is known, empty means legacy.
+func ValidFormat(format string) bool {
+	return format == "" || format == sysv1alpha1.FormatLegacy || IsCloudEvents(format)
+}
+
+// NewCloudEvent wraps the dispatch request in a CloudEvent.
+func NewCloudEvent(req *DispatchRequest) (*CloudEvent, error) {
+	data, err := json.Marshal(CloudEventData{
+		Op:       req.Op,
+		DataType: req.DataType,
+		Version:  req.Version,
+		Group:    req.Group,
+		AppKey:   req.AppKey,
+		Param:    req.Param,
+		Data:     req.Data,
+		Result:   req.Result,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &CloudEvent{
+		SpecVersion:     CloudEventsSpecVersion,
+		ID:              req.ID,
+		Source:          fmt.Sprintf("/system-server/v1alpha1/%s/%s/%s", req.DataType, req.Group, req.Version),
+		Type:            CloudEventTypePrefix + strings.ToLower(req.DataType+"."+req.Op),
+		Subject:         subject(req),
+		Time:            req.Time.UTC(),
+		DataContentType: restful.MIME_JSON,
+		Data:            data,
+		Cursor:          req.Cursor,
+	}, nil
+}
+
+// subject returns the data id the request operates on, if any.
+func subject(req *DispatchRequest) string {
+	switch p := req.Param.(type) {
+	case UpdateOpParam:
+		return p.DataID
+	case GetOpParam:
+		return p.DataID
+	case map[string]interface{}:
+		// decoded from the event log
+		if id, ok := p["dataid"].(string); ok {
+			return id
+		}
+	}
+
+	return ""
+}
+
+// BinaryHeaders returns the headers of the event in binary content mode, the body
+// is the data of event.
+func (e *CloudEvent) BinaryHeaders() http.Header {
+	header := http.Header{}
+	header.Set(cloudEventHeaderPrefix+"specversion", e.SpecVersion)
+	header.Set(cloudEventHeaderPrefix+"id", e.ID)
+	header.Set(cloudEventHeaderPrefix+"source", e.Source)
+	header.Set(cloudEventHeaderPrefix+"type", e.Type)
+	header.Set(cloudEventHeaderPrefix+"time", e.Time.Format(time.RFC3339Nano))
+	if e.Subject != "" {
+		header.Set(cloudEventHeaderPrefix+"subject", e.Subject)
+	}
+	if e.Cursor != 0 {
+		header.Set(cloudEventHeaderPrefix+"cursor", fmt.Sprint(e.Cursor))
+	}
+	header.Set(restful.HEADER_ContentType, e.DataContentType)
+
+	return header
+}
+
+// EncodeEvent encodes the dispatch request in the format, returns the content type
+// and body to deliver.
+func EncodeEvent(req *DispatchRequest, format string) (string, []byte, error) {
+	if !IsCloudEvents(format) {
+		body, err := json.Marshal(req)
+		return restful.MIME_JSON, body, err
+	}
+
+	event, err := NewCloudEvent(req)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// always persisted in structured mode, and converted to binary mode on delivery,
+	// so the attributes keep the same across retries
+	body, err := json.Marshal(event)
+	return CloudEventsContentType, body, err
+}
@@ -2,83 +2,388 @@ package serviceproxy
 
 import (
 	"context"
+	"crypto/ed25519"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 	"reflect"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	sysv1alpha1 "bytetrade.io/web3os/system-server/pkg/apis/sys/v1alpha1"
 	apiv1alpha1 "bytetrade.io/web3os/system-server/pkg/apiserver/v1alpha1/api"
 	"bytetrade.io/web3os/system-server/pkg/constants"
+	"bytetrade.io/web3os/system-server/pkg/metrics"
+	"bytetrade.io/web3os/system-server/pkg/pki"
 	prodiverregistry "bytetrade.io/web3os/system-server/pkg/providerregistry/v1alpha1"
-	"bytetrade.io/web3os/system-server/pkg/utils"
+	"bytetrade.io/web3os/system-server/pkg/tracing"
+	"bytetrade.io/web3os/system-server/pkg/webhook"
 
 	"github.com/emicklei/go-restful/v3"
-	"github.com/go-resty/resty/v2"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
 )
 
+const (
+	// DeliveryMaxAttempts is the number of attempts of a watcher delivery before
+	// it is moved to the dead-letter store.
+	DeliveryMaxAttempts = 10
+	DeliveryBaseDelay   = time.Second
+	DeliveryMaxDelay    = 10 * time.Minute
+
+	// DefaultWatcherWorkers is the number of concurrent deliveries per watcher,
+	// one delivers the callbacks of a watcher in order, a failed delivery holds
+	// up the later ones until it's delivered or dead.
+	DefaultWatcherWorkers = 1
+
+	// queuePrunePeriod is how often the queues of the deleted watchers are shut down.
+	queuePrunePeriod = time.Minute
+
+	// dispatchBacklog is the number of mutations waiting to be dispatched, the
+	// mutation requests block only if it's full.
+	dispatchBacklog = 1024
+)
+
+// DispatcherOptions holds the tunables of Dispatcher.
+type DispatcherOptions struct {
+	// Workers is the number of concurrent deliveries per watcher, more than one
+	// delivers the callbacks of a watcher out of order.
+	Workers int
+	// SigningKey signs the deliveries to the watchers without a secret.
+	SigningKey ed25519.PrivateKey
+	// EventLog records the dispatched requests for replay, optional.
+	EventLog *EventLog
+	// Cache is invalidated by the dispatched mutations, optional.
+	Cache *ResponseCache
+	// KubeClient reads the Secrets referenced by the watchers to sign their callbacks.
+	KubeClient kubernetes.Interface
+}
+
 type Dispatcher struct {
-	registry  *prodiverregistry.Registry
-	workqueue workqueue.RateLimitingInterface
-	serverCtx context.Context
+	registry   *prodiverregistry.Registry
+	outbox     *Outbox
+	eventLog   *EventLog
+	streams    *Broadcaster
+	cache      *ResponseCache
+	secrets    *watcherSecrets
+	workers    int
+	signingKey ed25519.PrivateKey
+	serverCtx  context.Context
+
+	// the mutations are dispatched in order off the request path
+	events chan *dispatchEvent
+
+	// every watcher has its own queue and workers, so that a failing or
+	// slow watcher doesn't hold up deliveries to the others
+	mu     sync.Mutex
+	queues map[string]workqueue.Interface
 }
 
-func NewDispatcher(ctx context.Context, registry *prodiverregistry.Registry) *Dispatcher {
+func NewDispatcher(ctx context.Context, registry *prodiverregistry.Registry, outbox *Outbox, options DispatcherOptions) *Dispatcher {
+	workers := options.Workers
+	if workers <= 0 {
+		workers = DefaultWatcherWorkers
+	}
+
 	dispatcher := &Dispatcher{
-		registry:  registry,
-		workqueue: workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "ContentWatcher"),
-		serverCtx: ctx,
+		registry:   registry,
+		outbox:     outbox,
+		eventLog:   options.EventLog,
+		streams:    NewBroadcaster(),
+		cache:      options.Cache,
+		secrets:    newWatcherSecrets(options.KubeClient),
+		workers:    workers,
+		signingKey: options.SigningKey,
+		serverCtx:  ctx,
+		events:     make(chan *dispatchEvent, dispatchBacklog),
+		queues:     make(map[string]workqueue.Interface),
+	}
+
+	// redeliver the deliveries left over by last run
+	pending, err := outbox.Pending()
+	if err != nil {
+		klog.Error("load pending deliveries error, ", err)
+	}
+	for _, delivery := range pending {
+		dispatcher.add(delivery.Watcher, delivery.ID)
 	}
+	klog.Info("pending deliveries restored, ", len(pending))
+
+	go dispatcher.runEvents()
+	go wait.Until(dispatcher.pruneQueues, queuePrunePeriod, ctx.Done())
+
+	if dispatcher.eventLog != nil {
+		go wait.Until(dispatcher.eventLog.Prune, time.Hour, ctx.Done())
+	}
+
+	go func() {
+		<-ctx.Done()
+		dispatcher.streams.Close()
+	}()
 
-	go dispatcher.runWorker()
 	return dispatcher
 }
 
-func (d *Dispatcher) DoWatch(req *DispatchRequest) {
-	d.workqueue.Add(req)
+// dispatchEvent is a mutation waiting to be dispatched, with the trace context
+// of the request.
+type dispatchEvent struct {
+	event       *DispatchRequest
+	traceParent string
+}
+
+// DoWatch invalidates the cached responses of the data type, and hands the request
+// over to be dispatched in the background, see dispatch.
+func (d *Dispatcher) DoWatch(ctx context.Context, req *DispatchRequest) {
+	if d.cache != nil {
+		d.cache.Invalidate(req.DataType, req.Group, req.Version)
+	}
+
+	// the access token of the caller is never shared with the subscribers and
+	// the watchers, nor persisted in the event log and the outbox
+	event := *req
+	event.Token = ""
+	event.Time = time.Now()
+
+	select {
+	case d.events <- &dispatchEvent{event: &event, traceParent: tracing.TraceParent(ctx)}:
+	case <-d.serverCtx.Done():
+	}
 }
 
-func (d *Dispatcher) runWorker() {
-	for d.processNextWorkItem() {
+func (d *Dispatcher) runEvents() {
+	for {
 		select {
+		case e := <-d.events:
+			d.dispatchEvent(e)
 		case <-d.serverCtx.Done():
 			return
-		default:
 		}
 	}
 }
 
-func (d *Dispatcher) processNextWorkItem() bool {
-	obj, shutdown := d.workqueue.Get()
+// dispatchEvent records the request in the event log, publishes it to the streaming
+// subscribers, persists a delivery for every watcher callback matching the request,
+// and queues them to be delivered.
+func (d *Dispatcher) dispatchEvent(e *dispatchEvent) {
+	event := e.event
+	ctx, span := tracing.Start(tracing.WithTraceParent(d.serverCtx, e.traceParent), "dispatch", trace.WithAttributes(
+		attribute.String("op", event.Op),
+		attribute.String("data_type", event.DataType),
+		attribute.String("group", event.Group),
+		attribute.String("version", event.Version),
+	))
+	defer span.End()
+
+	if err := d.record(event); err != nil {
+		// the watchers still get the delivery, only the replay misses it
+		utilruntime.HandleError(fmt.Errorf("record event err: %s", err.Error()))
+	}
 
-	if shutdown {
-		return false
+	// the cursor identifies the event in replay as well
+	if event.Cursor != 0 {
+		event.ID = strconv.FormatInt(event.Cursor, 10)
+	} else {
+		event.ID = uuid.New().String()
+	}
+	d.streams.Publish(event)
+
+	if err := d.enqueue(ctx, event); err != nil {
+		span.RecordError(err)
+		utilruntime.HandleError(err)
 	}
+}
 
-	err := func(obj interface{}) error {
-		defer d.workqueue.Done(obj)
+// record appends the request to the event log and sets its cursor.
+func (d *Dispatcher) record(req *DispatchRequest) error {
+	if d.eventLog == nil {
+		return nil
+	}
 
-		return d.dispatch(obj)
-	}(obj)
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
 
+	cursor, err := d.eventLog.Append(req.DataType, req.Group, req.Version, req.Op, payload, req.Time)
 	if err != nil {
-		utilruntime.HandleError(err)
-		return true
+		return err
+	}
+
+	req.Cursor = cursor
+	return nil
+}
+
+// Events returns the recorded events of the data type after cursor.
+func (d *Dispatcher) Events(dataType, group, version string, cursor int64, limit int) (*EventList, error) {
+	if d.eventLog == nil {
+		return nil, errors.New("event log is not enabled")
+	}
+
+	return d.eventLog.Since(dataType, group, version, cursor, limit)
+}
+
+// Subscribe starts streaming the dispatched events to the subscription.
+func (d *Dispatcher) Subscribe(sub *Subscription) {
+	d.streams.Subscribe(sub)
+}
+
+func (d *Dispatcher) Unsubscribe(sub *Subscription) {
+	d.streams.Unsubscribe(sub)
+}
+
+// queueFor returns the queue of the watcher, starting its workers on first use.
+func (d *Dispatcher) queueFor(watcher string) workqueue.Interface {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if queue, ok := d.queues[watcher]; ok {
+		return queue
+	}
+
+	// not named, the workqueue metrics can't be deleted with the watcher, the
+	// depth is reported by metrics.DispatcherQueueDepth instead. Not rate limited
+	// either, the workers retry the failed deliveries in place, see processNextWorkItem
+	queue := workqueue.New()
+	d.queues[watcher] = queue
+
+	go func() {
+		<-d.serverCtx.Done()
+		queue.ShutDown()
+	}()
+
+	klog.Info("starting dispatcher workers for watcher, ", watcher, ", workers: ", d.workers)
+	for i := 0; i < d.workers; i++ {
+		go d.runWorker(watcher, queue)
+	}
+
+	return queue
+}
+
+// add queues the delivery to its watcher.
+func (d *Dispatcher) add(watcher string, id int64) {
+	queue := d.queueFor(watcher)
+	queue.Add(id)
+	metrics.DispatcherQueueDepth.WithLabelValues(watcher).Set(float64(queue.Len()))
+}
+
+// pruneQueues shuts down the queues and workers of the deleted watchers, and
+// moves their pending deliveries to the dead-letter store.
+func (d *Dispatcher) pruneQueues() {
+	// the registry and the outbox are not called under the lock, it would hold
+	// up the mutations queueing their deliveries
+	d.mu.Lock()
+	queues := make(map[string]workqueue.Interface, len(d.queues))
+	for watcher, queue := range d.queues {
+		queues[watcher] = queue
 	}
+	d.mu.Unlock()
+
+	for watcher, queue := range queues {
+		_, err := d.registry.GetWatcher(d.serverCtx, watcher)
+		if err == nil {
+			continue
+		}
+
+		if !isWatcherNotFound(err) {
+			klog.Warning("get watcher ", watcher, " error, ", err)
+			continue
+		}
+
+		d.mu.Lock()
+		if d.queues[watcher] == queue {
+			klog.Info("watcher deleted, stopping dispatcher workers, ", watcher)
+			queue.ShutDown()
+			delete(d.queues, watcher)
+			metrics.DispatcherQueueDepth.DeleteLabelValues(watcher)
+			metrics.Deliveries.DeletePartialMatch(prometheus.Labels{"watcher": watcher})
+		}
+		d.mu.Unlock()
+
+		n, err := d.outbox.DeadWatcher(watcher, "watcher deleted")
+		if err != nil {
+			klog.Error("move deliveries of watcher ", watcher, " to dead letters error, ", err)
+			continue
+		}
+
+		if n > 0 {
+			klog.Info("deliveries of deleted watcher ", watcher, " moved to dead letters, ", n)
+		}
+	}
+}
 
-	return true
+// isWatcherNotFound reports whether err of a watcher lookup means the watcher is deleted.
+func isWatcherNotFound(err error) bool {
+	return apierrors.IsNotFound(err) || errors.Is(err, prodiverregistry.ErrProviderNotFound)
 }
 
-func (d *Dispatcher) dispatch(obj interface{}) error {
-	request, ok := obj.(*DispatchRequest)
+func (d *Dispatcher) runWorker(watcher string, queue workqueue.Interface) {
+	for d.processNextWorkItem(watcher, queue) {
+		select {
+		case <-d.serverCtx.Done():
+			return
+		default:
+		}
+	}
+}
+
+// processNextWorkItem delivers the head of the watcher queue. A failed delivery
+// is retried with backoff before the next one is taken, until it's delivered
+// or dead, so the callbacks of a watcher are delivered in order.
+func (d *Dispatcher) processNextWorkItem(watcher string, queue workqueue.Interface) bool {
+	obj, shutdown := queue.Get()
+
+	if shutdown {
+		return false
+	}
+	defer queue.Done(obj)
+	metrics.DispatcherQueueDepth.WithLabelValues(watcher).Set(float64(queue.Len()))
+
+	id, ok := obj.(int64)
 	if !ok {
-		return fmt.Errorf("invalid dispatch obj, %s, %v", reflect.TypeOf(obj), obj)
+		utilruntime.HandleError(fmt.Errorf("invalid delivery obj, %s, %v", reflect.TypeOf(obj), obj))
+		return true
+	}
+
+	for {
+		err := d.dispatch(id)
+		if err == nil {
+			return true
+		}
+
+		delay, err := d.retry(watcher, id, err)
+		utilruntime.HandleError(err)
+		if delay == 0 {
+			return true
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-d.serverCtx.Done():
+			return false
+		}
+
+		// the watcher is deleted meanwhile, its deliveries are dead already
+		if queue.ShuttingDown() {
+			return false
+		}
 	}
+}
 
-	klog.Info("dispatch request, ", utils.PrettyJSON(request))
+func (d *Dispatcher) enqueue(ctx context.Context, request *DispatchRequest) error {
+	klog.Info("dispatch request, ", request.Op, " ", request.DataType, ".", request.Group, "/", request.Version, ", app: ", request.AppKey)
 
 	watchers, err := d.registry.GetWatchers(d.serverCtx,
 		request.DataType,
@@ -92,9 +397,38 @@ func (d *Dispatcher) dispatch(obj interface{}) error {
 
 	klog.Info("find watchers, ", len(watchers))
 
+	// the deliveries are traced as the children of the dispatch later
+	traceParent := tracing.TraceParent(ctx)
+
+	// encoded once per format, shared by the callbacks
+	payloads := make(map[string][]byte)
+	encode := func(format string) ([]byte, error) {
+		if !IsCloudEvents(format) {
+			format = sysv1alpha1.FormatLegacy
+		}
+
+		if payload, ok := payloads[format]; ok {
+			return payload, nil
+		}
+
+		_, payload, err := EncodeEvent(request, format)
+		if err != nil {
+			return nil, err
+		}
+
+		payloads[format] = payload
+		return payload, nil
+	}
+
+	var errs []error
 	for _, w := range watchers {
 		for _, cb := range w.Spec.Callbacks {
-			filtered, err := watchFilter(request.Data, cb.Filters)
+			if !ValidFormat(cb.Format) {
+				klog.Error("watcher ", w.Name, " callback format unsupported, ", cb.Format)
+				continue
+			}
+
+			filtered, err := matchCallback(request, &cb)
 			if err != nil {
 				klog.Error("watcher filter error, ", err)
 				continue
@@ -106,75 +440,241 @@ func (d *Dispatcher) dispatch(obj interface{}) error {
 					strings.HasPrefix(w.Spec.Endpoint, "https://") {
 					url = fmt.Sprintf("%s%s", w.Spec.Endpoint, cb.URI)
 				} else {
-					url = fmt.Sprintf("http://%s%s", w.Spec.Endpoint, cb.URI)
+					url = fmt.Sprintf("%s://%s%s", pki.Scheme(), w.Spec.Endpoint, cb.URI)
 				}
 
 				klog.Info("watcher url: ", url)
 
-				client := resty.New()
-
-				resp, err := client.SetTimeout(2*time.Second).R().
-					SetHeader(restful.HEADER_ContentType, restful.MIME_JSON).
-					SetHeader(apiv1alpha1.BackendTokenHeader, constants.Nonce).
-					SetBody(request).
-					Post(url)
-
+				payload, err := encode(cb.Format)
 				if err != nil {
-					return fmt.Errorf("invoke watcher err: %s", err.Error())
+					errs = append(errs, fmt.Errorf("encode event to watcher %s err: %s", w.Name, err.Error()))
+					continue
 				}
 
-				if resp.StatusCode() >= 400 {
-					return fmt.Errorf("invoke watcher err: code %d, %s", resp.StatusCode(), string(resp.Body()))
+				id, err := d.outbox.Add(&Delivery{
+					Watcher:     w.Name,
+					Op:          cb.Op,
+					URL:         url,
+					Format:      cb.Format,
+					Payload:     payload,
+					TraceParent: traceParent,
+				})
+				if err != nil {
+					errs = append(errs, fmt.Errorf("persist delivery to watcher %s err: %s", w.Name, err.Error()))
+					continue
 				}
 
+				d.add(w.Name, id)
 			}
 		}
 	}
 
+	return utilerrors.NewAggregate(errs)
+}
+
+func (d *Dispatcher) dispatch(id int64) error {
+	delivery, err := d.outbox.Get(id)
+	if err != nil {
+		if errors.Is(err, ErrDeliveryNotFound) {
+			// discarded while it was queued
+			return nil
+		}
+		return err
+	}
+
+	if delivery.State != DeliveryPending {
+		return nil
+	}
+
+	// never delivered without the secret of the watcher, signed with the server
+	// key only, the watcher expects its secret
+	watcher, err := d.registry.GetWatcher(d.serverCtx, delivery.Watcher)
+	if err != nil {
+		if !isWatcherNotFound(err) {
+			return err
+		}
+
+		klog.Info("watcher ", delivery.Watcher, " deleted, delivery ", delivery.ID, " moved to dead letters")
+		if err = d.outbox.Dead(delivery.ID); err != nil {
+			return err
+		}
+
+		metrics.Deliveries.WithLabelValues(delivery.Watcher, "dead").Inc()
+		return nil
+	}
+
+	secret, err := d.secrets.Get(d.serverCtx, watcher)
+	if err != nil {
+		return err
+	}
+
+	header, body, err := deliveryContent(delivery)
+	if err != nil {
+		// a broken payload never gets delivered
+		klog.Error("decode delivery ", delivery.ID, " error, ", err)
+		if err = d.outbox.Dead(delivery.ID); err != nil {
+			return err
+		}
+
+		metrics.Deliveries.WithLabelValues(delivery.Watcher, "dead").Inc()
+		return nil
+	}
+	webhook.Sign(header, secret, d.signingKey, strconv.FormatInt(delivery.ID, 10), body)
+
+	ctx, span := tracing.Start(tracing.WithTraceParent(d.serverCtx, delivery.TraceParent), "deliver "+delivery.Op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("watcher.name", delivery.Watcher),
+			attribute.Int("delivery.attempt", delivery.Attempts+1),
+			semconv.URLFull(delivery.URL),
+		))
+	tracing.Inject(ctx, header)
+
+	client := newRestyClient()
+
+	resp, err := client.SetTimeout(2*time.Second).R().
+		SetHeader(apiv1alpha1.BackendTokenHeader, constants.Nonce).
+		SetHeaderMultiValues(header).
+		SetBody(body).
+		Post(delivery.URL)
+
+	if err != nil {
+		err = fmt.Errorf("invoke watcher err: %s", err.Error())
+		tracing.End(span, err)
+		return err
+	}
+
+	if resp.StatusCode() >= 400 {
+		err = fmt.Errorf("invoke watcher err: code %d, %s", resp.StatusCode(), string(resp.Body()))
+		tracing.End(span, err)
+		return err
+	}
+	span.End()
+
+	if err = d.outbox.Delete(id); err != nil {
+		return err
+	}
+
+	metrics.Deliveries.WithLabelValues(delivery.Watcher, "delivered").Inc()
 	return nil
 }
 
-func watchFilter(data any, filter map[string][]string) (bool, error) {
-	if filter == nil {
-		return true, nil
+// deliveryContent returns the headers and body of the delivery in its format.
+func deliveryContent(delivery *Delivery) (http.Header, []byte, error) {
+	header := http.Header{}
+
+	switch delivery.Format {
+	case sysv1alpha1.FormatCloudEvents:
+		header.Set(restful.HEADER_ContentType, CloudEventsContentType)
+		return header, delivery.Payload, nil
+
+	case sysv1alpha1.FormatCloudEventsBinary:
+		var event CloudEvent
+		if err := json.Unmarshal(delivery.Payload, &event); err != nil {
+			return nil, nil, err
+		}
+
+		return event.BinaryHeaders(), event.Data, nil
 	}
 
-	jsonData, err := json.Marshal(data)
+	header.Set(restful.HEADER_ContentType, restful.MIME_JSON)
+	return header, delivery.Payload, nil
+}
+
+// retry records the failed attempt, and returns the backoff before the delivery
+// is attempted again, or moves it to the dead-letter store after DeliveryMaxAttempts
+// and returns 0.
+func (d *Dispatcher) retry(watcher string, id int64, deliverErr error) (time.Duration, error) {
+	metrics.Deliveries.WithLabelValues(watcher, "failed").Inc()
+
+	attempts, err := d.outbox.Failed(id, deliverErr.Error())
 	if err != nil {
-		return false, err
+		// keep retrying, the delivery is still in the outbox
+		return DeliveryBaseDelay, fmt.Errorf("record delivery %d failure err: %s, %v", id, err.Error(), deliverErr)
+	}
+
+	if attempts >= DeliveryMaxAttempts {
+		if err = d.outbox.Dead(id); err != nil {
+			return DeliveryBaseDelay, err
+		}
+
+		metrics.Deliveries.WithLabelValues(watcher, "dead").Inc()
+		return 0, fmt.Errorf("delivery %d dead after %d attempts: %v", id, attempts, deliverErr)
+	}
+
+	delay := deliveryBackoff(attempts)
+	return delay, fmt.Errorf("delivery %d failed, attempts %d, retrying in %s: %v", id, attempts, delay, deliverErr)
+}
+
+// deliveryBackoff returns the exponential backoff after the attempts of a delivery.
+func deliveryBackoff(attempts int) time.Duration {
+	delay := DeliveryBaseDelay
+	for i := 1; i < attempts && delay < DeliveryMaxDelay; i++ {
+		delay *= 2
 	}
 
-	var filterData map[string]interface{}
-	err = json.Unmarshal(jsonData, &filterData)
+	if delay > DeliveryMaxDelay {
+		return DeliveryMaxDelay
+	}
+	return delay
+}
+
+// PublicKey returns the public key to verify the deliveries signed by the server.
+func (d *Dispatcher) PublicKey() ed25519.PublicKey {
+	if d.signingKey == nil {
+		return nil
+	}
+
+	return d.signingKey.Public().(ed25519.PublicKey)
+}
+
+// DeadLetters lists the deliveries that ran out of attempts.
+func (d *Dispatcher) DeadLetters() ([]*Delivery, error) {
+	return d.outbox.DeadLetters()
+}
+
+func (d *Dispatcher) DeadLetter(id int64) (*Delivery, error) {
+	delivery, err := d.outbox.Get(id)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
-	for q, v := range filter {
-		if f, ok := filterData[q]; ok {
-			var field string
+	if delivery.State != DeliveryDead {
+		return nil, ErrDeliveryNotFound
+	}
 
-			switch f := f.(type) {
-			// just app metadata can be filtered
-			case string:
-				field = f
-			case float64:
-				field = fmt.Sprintf("%f", f)
-			}
+	return delivery, nil
+}
 
-			found := false
-			for _, s := range v {
-				if s == field {
-					found = true
-				}
-			}
+// Redrive puts a dead letter back to the queue with fresh attempts.
+func (d *Dispatcher) Redrive(id int64) error {
+	delivery, err := d.DeadLetter(id)
+	if err != nil {
+		return err
+	}
 
-			if !found {
-				return false, nil
-			}
+	// a deleted watcher would get its queue back, and the delivery dead again
+	if _, err = d.registry.GetWatcher(d.serverCtx, delivery.Watcher); err != nil {
+		if isWatcherNotFound(err) {
+			return apiv1alpha1.NewError(apiv1alpha1.ReasonConflict,
+				fmt.Errorf("watcher %s of delivery %d is deleted", delivery.Watcher, id))
 		}
+		return err
+	}
+
+	if err = d.outbox.Redrive(id); err != nil {
+		return err
+	}
+
+	d.add(delivery.Watcher, id)
+	return nil
+}
 
+// Discard drops a dead letter for good.
+func (d *Dispatcher) Discard(id int64) error {
+	if _, err := d.DeadLetter(id); err != nil {
+		return err
 	}
 
-	return true, nil
+	return d.outbox.Delete(id)
 }
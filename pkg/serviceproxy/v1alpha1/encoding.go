@@ -0,0 +1,286 @@
+package serviceproxy
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	EncodingGzip     = "gzip"
+	EncodingBrotli   = "br"
+	EncodingZstd     = "zstd"
+	EncodingIdentity = "identity"
+
+	// minCompressSize is the min length of the identity responses compressed by the
+	// proxy, the unknown length is always compressed.
+	minCompressSize = 1024
+)
+
+// supportedEncodings are the content codings the proxy decodes and encodes, in the
+// order of preference on the same quality.
+var supportedEncodings = []string{EncodingZstd, EncodingBrotli, EncodingGzip}
+
+// acceptEncoding is a parsed Accept-Encoding header, coding -> qvalue.
+type acceptEncoding map[string]float64
+
+func parseAcceptEncoding(header string) acceptEncoding {
+	accept := acceptEncoding{}
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(fields[0]))
+		if coding == "" {
+			continue
+		}
+		if coding == "x-gzip" {
+			coding = EncodingGzip
+		}
+
+		q := 1.0
+		for _, param := range fields[1:] {
+			k, v, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok && strings.TrimSpace(k) == "q" {
+				if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+					q = f
+				}
+			}
+		}
+		accept[coding] = q
+	}
+
+	return accept
+}
+
+// quality returns the qvalue of coding, RFC 9110 section 12.5.3.
+func (a acceptEncoding) quality(coding string) float64 {
+	if q, ok := a[coding]; ok {
+		return q
+	}
+	if q, ok := a["*"]; ok {
+		return q
+	}
+	if coding == EncodingIdentity {
+		return 1
+	}
+
+	return 0
+}
+
+func (a acceptEncoding) accepts(coding string) bool {
+	return a.quality(coding) > 0
+}
+
+// preferred returns the supported coding the client prefers, empty if none.
+func (a acceptEncoding) preferred() string {
+	codings := make([]string, 0, len(supportedEncodings))
+	for _, c := range supportedEncodings {
+		if a.accepts(c) {
+			codings = append(codings, c)
+		}
+	}
+
+	sort.SliceStable(codings, func(i, j int) bool {
+		return a.quality(codings[i]) > a.quality(codings[j])
+	})
+
+	if len(codings) == 0 {
+		return ""
+	}
+
+	return codings[0]
+}
+
+// UpstreamAcceptEncoding returns the Accept-Encoding sent to the provider, the
+// codings of the client the proxy can decode, so the response is passed through
+// in most cases and transcoded only if the provider ignores it.
+func UpstreamAcceptEncoding(clientHeader string) string {
+	accept := parseAcceptEncoding(clientHeader)
+
+	var codings []string
+	for _, c := range supportedEncodings {
+		if q := accept.quality(c); q > 0 {
+			codings = append(codings, c+";q="+strconv.FormatFloat(q, 'f', -1, 64))
+		}
+	}
+
+	if len(codings) == 0 {
+		return EncodingIdentity
+	}
+
+	return strings.Join(codings, ", ")
+}
+
+// ResponseEncoding is the negotiated transcoding of a provider response, the body
+// encoded by the provider is decoded by Decode and encoded again by Encode.
+type ResponseEncoding struct {
+	Decode string
+	Encode string
+}
+
+// NegotiateResponseEncoding decides how to deliver the provider response to the
+// client. The response encoded by the provider is passed through if the client
+// accepts it, otherwise it's decoded and encoded in a coding the client accepts,
+// it's never encoded twice. The identity responses are compressed if the client
+// accepts, except the event streams, which are flushed line by line.
+func NegotiateResponseEncoding(method, clientAcceptEncoding string, resp *http.Response) *ResponseEncoding {
+	accept := parseAcceptEncoding(clientAcceptEncoding)
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	if encoding == "x-gzip" {
+		encoding = EncodingGzip
+	}
+
+	noBody := method == http.MethodHead || resp.StatusCode == http.StatusNoContent ||
+		resp.StatusCode == http.StatusNotModified || resp.StatusCode == http.StatusPartialContent
+
+	switch {
+	case noBody:
+		// the partial content is a range of the encoded body, never touch it
+		return &ResponseEncoding{}
+
+	case encoding != "" && encoding != EncodingIdentity:
+		if accept.accepts(encoding) || !isSupportedEncoding(encoding) {
+			return &ResponseEncoding{}
+		}
+
+		e := &ResponseEncoding{Decode: encoding}
+		if !isStreamingResponse(resp.Header) {
+			e.Encode = accept.preferred()
+		}
+		return e
+
+	case isStreamingResponse(resp.Header) || !isCompressible(resp.Header.Get("Content-Type")):
+		return &ResponseEncoding{}
+
+	case resp.ContentLength >= 0 && resp.ContentLength < minCompressSize:
+		return &ResponseEncoding{}
+
+	default:
+		return &ResponseEncoding{Encode: accept.preferred()}
+	}
+}
+
+// Transcoding returns whether the body is changed.
+func (e *ResponseEncoding) Transcoding() bool {
+	return e.Decode != "" || e.Encode != ""
+}
+
+// SetHeader fixes the response headers for the transcoded body, the encoded body
+// passed through varies on Accept-Encoding as well.
+func (e *ResponseEncoding) SetHeader(header http.Header) {
+	if !e.Transcoding() {
+		if encoding := header.Get("Content-Encoding"); encoding != "" && encoding != EncodingIdentity {
+			addVary(header, "Accept-Encoding")
+		}
+		return
+	}
+
+	header.Del("Content-Length")
+	header.Del("Content-Encoding")
+	// the validators of the provider are for its own representation
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		header.Set("ETag", "W/"+etag)
+	}
+	if e.Encode != "" {
+		header.Set("Content-Encoding", e.Encode)
+	}
+	addVary(header, "Accept-Encoding")
+}
+
+// addVary adds the field to the Vary header, unless it's already there.
+func addVary(header http.Header, field string) {
+	for _, v := range header.Values("Vary") {
+		for _, f := range strings.Split(v, ",") {
+			f = strings.TrimSpace(f)
+			if f == "*" || strings.EqualFold(f, field) {
+				return
+			}
+		}
+	}
+
+	header.Add("Vary", field)
+}
+
+// Reader returns the decoded body.
+func (e *ResponseEncoding) Reader(body io.Reader) (io.ReadCloser, error) {
+	switch e.Decode {
+	case EncodingGzip:
+		return gzip.NewReader(body)
+	case EncodingBrotli:
+		return io.NopCloser(brotli.NewReader(body)), nil
+	case EncodingZstd:
+		d, err := zstd.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	default:
+		return io.NopCloser(body), nil
+	}
+}
+
+// Writer returns the writer encoding the body to w, it must be closed to flush.
+func (e *ResponseEncoding) Writer(w io.Writer) (io.WriteCloser, error) {
+	switch e.Encode {
+	case EncodingGzip:
+		return gzip.NewWriter(w), nil
+	case EncodingBrotli:
+		return brotli.NewWriterLevel(w, brotli.DefaultCompression), nil
+	case EncodingZstd:
+		return zstd.NewWriter(w)
+	default:
+		return nopWriteCloser{w}, nil
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+func isSupportedEncoding(encoding string) bool {
+	for _, e := range supportedEncodings {
+		if e == encoding {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isStreamingResponse returns whether the response is an event stream.
+func isStreamingResponse(header http.Header) bool {
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	return mediaType == "text/event-stream" || mediaType == "application/x-ndjson"
+}
+
+// isCompressible returns whether the content type is worth compressing, the media
+// like images and archives are compressed already.
+func isCompressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "+json"),
+		strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+
+	switch mediaType {
+	case "application/json", "application/xml", "application/javascript",
+		"application/x-www-form-urlencoded", "image/svg+xml":
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,213 @@
+package serviceproxy
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"k8s.io/klog/v2"
+)
+
+const (
+	DefaultEventRetentionCount = 10000
+	DefaultEventRetentionAge   = 7 * 24 * time.Hour
+
+	// MaxEventsPerPage is the max number of events returned by a replay.
+	MaxEventsPerPage = 500
+
+	// eventTrimBatch is the number of appends to a data type between the trims of
+	// its events to the retention count.
+	eventTrimBatch = 100
+)
+
+var eventLogSchema = `
+CREATE TABLE IF NOT EXISTS events (
+	cursor     INTEGER PRIMARY KEY AUTOINCREMENT,
+	datatype   TEXT NOT NULL,
+	grp        TEXT NOT NULL,
+	version    TEXT NOT NULL,
+	op         TEXT NOT NULL,
+	payload    BLOB NOT NULL,
+	created_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_events_gdv ON events(datatype, grp, version, cursor);
+`
+
+// Event is a dispatched request recorded in the event log.
+type Event struct {
+	Cursor    int64           `db:"cursor" json:"cursor"`
+	DataType  string          `db:"datatype" json:"datatype"`
+	Group     string          `db:"grp" json:"group"`
+	Version   string          `db:"version" json:"version"`
+	Op        string          `db:"op" json:"op"`
+	Payload   json.RawMessage `db:"payload" json:"payload"`
+	CreatedAt int64           `db:"created_at" json:"createdAt"`
+	// CreatedAtNano is the time of the dispatch in nanoseconds, 0 for the events
+	// recorded by an older version.
+	CreatedAtNano int64 `db:"created_at_ns" json:"-"`
+}
+
+// DispatchRequest decodes the recorded dispatch request.
+func (e *Event) DispatchRequest() (*DispatchRequest, error) {
+	var req DispatchRequest
+	if err := json.Unmarshal(e.Payload, &req); err != nil {
+		return nil, err
+	}
+
+	req.Cursor = e.Cursor
+	req.ID = strconv.FormatInt(e.Cursor, 10)
+	req.Time = time.Unix(e.CreatedAt, 0)
+	if e.CreatedAtNano != 0 {
+		req.Time = time.Unix(0, e.CreatedAtNano)
+	}
+	return &req, nil
+}
+
+// EventList is a page of events after a cursor.
+type EventList struct {
+	Events []*Event `json:"events"`
+	// Cursor is the cursor to fetch the next page with.
+	Cursor int64 `json:"cursor"`
+	More   bool  `json:"more"`
+	// Truncated is true if some events after the requested cursor have been
+	// dropped by the retention.
+	Truncated bool `json:"truncated"`
+}
+
+// EventLog records the dispatched requests per datatype, group and version with
+// monotonically increasing cursors, so that watchers can replay the missed events.
+type EventLog struct {
+	db             *sqlx.DB
+	retentionCount int
+	retentionAge   time.Duration
+
+	mu      sync.Mutex
+	appends map[string]int // appends per data type since the last trim
+}
+
+// NewEventLog creates the event log in the dispatcher store.
+func NewEventLog(db *sqlx.DB, retentionCount int, retentionAge time.Duration) (*EventLog, error) {
+	if _, err := db.Exec(eventLogSchema); err != nil {
+		return nil, err
+	}
+
+	if err := ensureColumn(db, "events", "created_at_ns", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return nil, err
+	}
+
+	if retentionCount <= 0 {
+		retentionCount = DefaultEventRetentionCount
+	}
+
+	if retentionAge <= 0 {
+		retentionAge = DefaultEventRetentionAge
+	}
+
+	return &EventLog{
+		db:             db,
+		retentionCount: retentionCount,
+		retentionAge:   retentionAge,
+		appends:        make(map[string]int),
+	}, nil
+}
+
+// Append records the event dispatched at the time and returns its cursor.
+func (l *EventLog) Append(dataType, group, version, op string, payload []byte, at time.Time) (int64, error) {
+	res, err := l.db.Exec(`INSERT INTO events (datatype, grp, version, op, payload, created_at, created_at_ns) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		dataType, group, version, op, payload, at.Unix(), at.UnixNano())
+	if err != nil {
+		return 0, err
+	}
+
+	cursor, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	// keep the latest events of the data type only, trimmed in batches so that the
+	// data type holds at most eventTrimBatch events over the retention count
+	key := dataType + "/" + group + "/" + version
+	l.mu.Lock()
+	l.appends[key]++
+	trim := l.appends[key] >= eventTrimBatch
+	if trim {
+		delete(l.appends, key)
+	}
+	l.mu.Unlock()
+
+	if trim {
+		l.trim(dataType, group, version)
+	}
+
+	return cursor, nil
+}
+
+// trim drops the events of the data type over the retention count.
+func (l *EventLog) trim(dataType, group, version string) {
+	_, err := l.db.Exec(`DELETE FROM events WHERE datatype = ? AND grp = ? AND version = ? AND cursor < (
+		SELECT MIN(cursor) FROM (SELECT cursor FROM events WHERE datatype = ? AND grp = ? AND version = ? ORDER BY cursor DESC LIMIT ?))`,
+		dataType, group, version, dataType, group, version, l.retentionCount)
+	if err != nil {
+		klog.Error("trim event log error, ", err)
+	}
+}
+
+// Since returns the events after cursor, at most limit events.
+func (l *EventLog) Since(dataType, group, version string, cursor int64, limit int) (*EventList, error) {
+	if limit <= 0 || limit > MaxEventsPerPage {
+		limit = MaxEventsPerPage
+	}
+
+	events := make([]*Event, 0)
+	err := l.db.Select(&events, `SELECT * FROM events WHERE datatype = ? AND grp = ? AND version = ? AND cursor > ?
+		ORDER BY cursor LIMIT ?`, dataType, group, version, cursor, limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	list := &EventList{Cursor: cursor}
+	if len(events) > limit {
+		events = events[:limit]
+		list.More = true
+	}
+	list.Events = events
+
+	if len(events) > 0 {
+		list.Cursor = events[len(events)-1].Cursor
+		list.Truncated = cursor > 0 && events[0].Cursor > cursor+1 && l.dropped(dataType, group, version, cursor)
+	}
+
+	return list, nil
+}
+
+// dropped returns whether the event at cursor has been dropped by the retention.
+// The cursors are shared by all data types, so a gap between cursors alone could
+// just be the events of the others.
+func (l *EventLog) dropped(dataType, group, version string, cursor int64) bool {
+	var count int
+	err := l.db.Get(&count, `SELECT COUNT(*) FROM events WHERE datatype = ? AND grp = ? AND version = ? AND cursor <= ?`,
+		dataType, group, version, cursor)
+	if err != nil {
+		klog.Error("count events error, ", err)
+		return false
+	}
+
+	// the requested cursor is older than any retained event
+	return count == 0
+}
+
+// Prune drops the events older than the retention age.
+func (l *EventLog) Prune() {
+	before := time.Now().Add(-l.retentionAge).Unix()
+	res, err := l.db.Exec(`DELETE FROM events WHERE created_at < ?`, before)
+	if err != nil {
+		klog.Error("prune event log error, ", err)
+		return
+	}
+
+	if n, _ := res.RowsAffected(); n > 0 {
+		klog.Info("event log pruned, ", n)
+	}
+}
@@ -0,0 +1,329 @@
+package serviceproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	sysv1alpha1 "bytetrade.io/web3os/system-server/pkg/apis/sys/v1alpha1"
+
+	"github.com/google/cel-go/cel"
+	"github.com/jellydator/ttlcache/v3"
+)
+
+const (
+	// filterCacheCapacity is the max compiled expressions and regexps kept, the
+	// least recently used are evicted.
+	filterCacheCapacity = 1000
+
+	// celCostLimit is the max cost of evaluating an expression on an event, the
+	// expressions run out of the limit never match.
+	celCostLimit = 10000
+)
+
+var (
+	celEnv      *cel.Env
+	celEnvErr   error
+	celEnvOnce  sync.Once
+	celPrograms = ttlcache.New(ttlcache.WithCapacity[string, cel.Program](filterCacheCapacity))
+
+	regexps = ttlcache.New(ttlcache.WithCapacity[string, *regexp.Regexp](filterCacheCapacity))
+)
+
+// matchCallback returns whether the dispatch request passes all the filters of callback.
+func matchCallback(request *DispatchRequest, cb *sysv1alpha1.Callback) (bool, error) {
+	if cb.Filters == nil && len(cb.Rules) == 0 && cb.Expression == "" {
+		return true, nil
+	}
+
+	data, err := toJSONValue(request.Data)
+	if err != nil {
+		return false, err
+	}
+
+	if ok := watchFilter(data, cb.Filters); !ok {
+		return false, nil
+	}
+
+	for _, rule := range cb.Rules {
+		ok, err := matchRule(data, &rule)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+
+	if cb.Expression != "" {
+		return evalExpression(request, cb.Expression)
+	}
+
+	return true, nil
+}
+
+// watchFilter matches the fields of data with exact values, the missing fields are ignored.
+func watchFilter(data any, filter map[string][]string) bool {
+	for q, v := range filter {
+		if f, ok := lookup(data, q); ok {
+			var field string
+
+			switch f := f.(type) {
+			// just app metadata can be filtered
+			case string:
+				field = f
+			case float64:
+				field = fmt.Sprintf("%f", f)
+			}
+
+			found := false
+			for _, s := range v {
+				if s == field {
+					found = true
+				}
+			}
+
+			if !found {
+				return false
+			}
+		}
+
+	}
+
+	return true
+}
+
+func matchRule(data any, rule *sysv1alpha1.FilterRule) (bool, error) {
+	field, exists := lookup(data, rule.Path)
+
+	switch rule.Operator {
+	case sysv1alpha1.FilterExists:
+		return exists, nil
+	case sysv1alpha1.FilterDoesNotExist:
+		return !exists, nil
+	}
+
+	if !exists {
+		return false, nil
+	}
+
+	switch rule.Operator {
+	case sysv1alpha1.FilterIn, "":
+		return anyValue(field, rule.Values, func(f, v string) bool { return f == v }), nil
+
+	case sysv1alpha1.FilterNotIn:
+		return !anyValue(field, rule.Values, func(f, v string) bool { return f == v }), nil
+
+	case sysv1alpha1.FilterPrefix:
+		return anyValue(field, rule.Values, strings.HasPrefix), nil
+
+	case sysv1alpha1.FilterRegex:
+		var err error
+		matched := anyValue(field, rule.Values, func(f, v string) bool {
+			re, e := compileRegexp(v)
+			if e != nil {
+				err = e
+				return false
+			}
+			return re.MatchString(f)
+		})
+		return matched, err
+
+	case sysv1alpha1.FilterGt, sysv1alpha1.FilterLt, sysv1alpha1.FilterRange:
+		return matchNumber(field, rule)
+
+	default:
+		return false, fmt.Errorf("unsupported filter operator %q", rule.Operator)
+	}
+}
+
+func matchNumber(field any, rule *sysv1alpha1.FilterRule) (bool, error) {
+	n, ok := field.(float64)
+	if !ok {
+		if s, isString := field.(string); isString {
+			var err error
+			if n, err = strconv.ParseFloat(s, 64); err != nil {
+				return false, nil
+			}
+		} else {
+			return false, nil
+		}
+	}
+
+	bound := func(i int) (float64, bool, error) {
+		if i >= len(rule.Values) || rule.Values[i] == "" {
+			return 0, false, nil
+		}
+
+		b, err := strconv.ParseFloat(rule.Values[i], 64)
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid numeric value of filter %s, %s", rule.Path, rule.Values[i])
+		}
+		return b, true, nil
+	}
+
+	switch rule.Operator {
+	case sysv1alpha1.FilterGt:
+		b, ok, err := bound(0)
+		return ok && n > b, err
+	case sysv1alpha1.FilterLt:
+		b, ok, err := bound(0)
+		return ok && n < b, err
+	default:
+		lo, hasLo, err := bound(0)
+		if err != nil {
+			return false, err
+		}
+		hi, hasHi, err := bound(1)
+		if err != nil {
+			return false, err
+		}
+		return (!hasLo || n >= lo) && (!hasHi || n <= hi), nil
+	}
+}
+
+// anyValue returns whether the field, or any item of the field if it is a list,
+// matches any value.
+func anyValue(field any, values []string, match func(field, value string) bool) bool {
+	var fields []string
+	switch f := field.(type) {
+	case []any:
+		for _, item := range f {
+			fields = append(fields, stringify(item))
+		}
+	default:
+		fields = []string{stringify(f)}
+	}
+
+	for _, f := range fields {
+		for _, v := range values {
+			if match(f, v) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func stringify(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case nil:
+		return ""
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
+
+// lookup returns the field of the dotted json path in data.
+func lookup(data any, path string) (any, bool) {
+	current := data
+	for _, key := range strings.Split(path, ".") {
+		switch c := current.(type) {
+		case map[string]any:
+			v, ok := c[key]
+			if !ok {
+				return nil, false
+			}
+			current = v
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(c) {
+				return nil, false
+			}
+			current = c[i]
+		default:
+			return nil, false
+		}
+	}
+
+	return current, true
+}
+
+func toJSONValue(v any) (any, error) {
+	jsonData, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var value any
+	err = json.Unmarshal(jsonData, &value)
+	return value, err
+}
+
+func compileRegexp(pattern string) (*regexp.Regexp, error) {
+	if item := regexps.Get(pattern); item != nil {
+		return item.Value(), nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	regexps.Set(pattern, re, ttlcache.NoTTL)
+	return re, nil
+}
+
+func evalExpression(request *DispatchRequest, expression string) (bool, error) {
+	program, err := compileExpression(expression)
+	if err != nil {
+		return false, err
+	}
+
+	event, err := toJSONValue(request)
+	if err != nil {
+		return false, err
+	}
+
+	// the access token of the caller is never exposed to the expressions
+	if fields, ok := event.(map[string]any); ok {
+		delete(fields, "Token")
+	}
+
+	out, _, err := program.Eval(map[string]any{"event": event})
+	if err != nil {
+		// e.g. no such key or out of the cost limit, the event doesn't match
+		return false, nil
+	}
+
+	matched, ok := out.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("filter expression %q does not return bool", expression)
+	}
+
+	return matched, nil
+}
+
+func compileExpression(expression string) (cel.Program, error) {
+	if item := celPrograms.Get(expression); item != nil {
+		return item.Value(), nil
+	}
+
+	celEnvOnce.Do(func() {
+		celEnv, celEnvErr = cel.NewEnv(cel.Variable("event", cel.DynType))
+	})
+	if celEnvErr != nil {
+		return nil, celEnvErr
+	}
+
+	ast, issues := celEnv.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, fmt.Errorf("invalid filter expression %q, %v", expression, issues.Err())
+	}
+
+	program, err := celEnv.Program(ast, cel.CostLimit(celCostLimit))
+	if err != nil {
+		return nil, err
+	}
+
+	celPrograms.Set(expression, program, ttlcache.NoTTL)
+	return program, nil
+}
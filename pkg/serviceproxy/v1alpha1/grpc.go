@@ -0,0 +1,207 @@
+package serviceproxy
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	sysv1alpha1 "bytetrade.io/web3os/system-server/pkg/apis/sys/v1alpha1"
+	apiv1alpha1 "bytetrade.io/web3os/system-server/pkg/apiserver/v1alpha1/api"
+	"bytetrade.io/web3os/system-server/pkg/constants"
+	"bytetrade.io/web3os/system-server/pkg/pki"
+
+	"golang.org/x/net/http2"
+	"google.golang.org/grpc/codes"
+	"k8s.io/klog/v2"
+)
+
+const (
+	GRPCContentType = "application/grpc"
+
+	// the provider of the grpc calls not prefixed with the legacy v2 path, since
+	// most of the grpc clients can't prefix the method path
+	GRPCGroupHeader   = "X-Provider-Group"
+	GRPCVersionHeader = "X-Provider-Version"
+)
+
+var (
+	// h2cTransport calls the providers with HTTP/2 in cleartext, the connections are
+	// shared by the calls to the same provider.
+	h2cTransport = &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+
+	// tlsTransport calls the providers with https endpoints, created at the first
+	// call since the certificate of system-server is ready after startup.
+	tlsTransport     *http2.Transport
+	tlsTransportOnce sync.Once
+)
+
+func grpcTLSTransport() *http2.Transport {
+	tlsTransportOnce.Do(func() {
+		tlsTransport = &http2.Transport{TLSClientConfig: pki.ClientTLSConfig()}
+	})
+
+	return tlsTransport
+}
+
+// IsGRPCRequest returns whether the request is a grpc call.
+func IsGRPCRequest(r *http.Request) bool {
+	return r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), GRPCContentType)
+}
+
+// GRPCMethod returns the group, version and the method path of a grpc call, it's
+// either prefixed with the legacy v2 path of legacy_api, e.g.
+// /system-server/v2/legacy_api/<group>/<version>/<package>.<Service>/<Method>,
+// or the provider is in the X-Provider-Group and X-Provider-Version headers.
+func GRPCMethod(r *http.Request) (group, version, method string, err error) {
+	prefix := LEAGCY_PATCH_V2 + "/" + sysv1alpha1.LegacyAPI + "/"
+	if rest, ok := strings.CutPrefix(r.URL.Path, prefix); ok {
+		parts := strings.SplitN(rest, "/", 3)
+		if len(parts) != 3 || parts[2] == "" {
+			return "", "", "", fmt.Errorf("invalid grpc method path %s", r.URL.Path)
+		}
+
+		return parts[0], parts[1], "/" + parts[2], nil
+	}
+
+	group, version = r.Header.Get(GRPCGroupHeader), r.Header.Get(GRPCVersionHeader)
+	if group == "" || version == "" {
+		return "", "", "", fmt.Errorf("%s and %s are required", GRPCGroupHeader, GRPCVersionHeader)
+	}
+
+	return group, version, r.URL.Path, nil
+}
+
+// ProxyGRPC proxies the grpc call to the legacy_api provider of group and version,
+// the streams and trailers are passed through as is.
+func (p *Proxy) ProxyGRPC(ctx context.Context, group, version, method string, w http.ResponseWriter, r *http.Request) error {
+	provider, err := p.registry.GetProvider(ctx, sysv1alpha1.LegacyAPI, group, version)
+	if err != nil {
+		return err
+	}
+
+	endpoint := provider.Spec.Endpoint
+	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		endpoint = pki.Scheme() + "://" + endpoint
+	}
+
+	target, err := url.Parse(endpoint)
+	if err != nil {
+		return err
+	}
+
+	var transport http.RoundTripper = h2cTransport
+	if target.Scheme == "https" {
+		transport = grpcTLSTransport()
+	}
+
+	klog.Info("grpc provider url: ", target.String(), method)
+
+	// the headers of r are cloned to the call, with the trace context of the span
+	span := startProviderRequest(ctx, provider.Name, method, target.String()+method, r.Header)
+	start := time.Now()
+
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.Out.URL.Scheme = target.Scheme
+			pr.Out.URL.Host = target.Host
+			pr.Out.URL.Path = strings.TrimSuffix(target.Path, "/") + method
+			pr.Out.URL.RawPath = ""
+			pr.Out.Host = target.Host
+			pr.SetXForwarded()
+
+			pr.Out.Header.Set(apiv1alpha1.BackendTokenHeader, constants.Nonce)
+			pr.Out.Header.Set(constants.BflUserKey, constants.Owner)
+			pr.Out.Header.Del(GRPCGroupHeader)
+			pr.Out.Header.Del(GRPCVersionHeader)
+			// the credentials of the app are for system-server only
+			pr.Out.Header.Del("X-App-Key")
+			pr.Out.Header.Del("X-Auth-Signature")
+		},
+		Transport: transport,
+		// every message of the streams is flushed immediately
+		FlushInterval: -1,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			klog.Error("grpc proxy error, ", method, ", ", err)
+			WriteGRPCError(w, codes.Unavailable, err.Error())
+		},
+	}
+
+	proxy.ServeHTTP(w, r)
+	endProviderRequest(span, provider.Name, method, start, grpcError(GRPCStatus(w.Header())))
+
+	return nil
+}
+
+// GRPCStatus returns the status of the grpc response in header, in the headers of
+// a trailers-only response or the trailers, Unknown if it's missing.
+func GRPCStatus(header http.Header) codes.Code {
+	status := header.Get("Grpc-Status")
+	if status == "" {
+		status = header.Get(http.TrailerPrefix + "Grpc-Status")
+	}
+
+	code, err := strconv.Atoi(status)
+	if err != nil {
+		return codes.Unknown
+	}
+
+	return codes.Code(code)
+}
+
+// grpcError returns the error of a grpc call failed with code, nil if it's OK.
+func grpcError(code codes.Code) error {
+	var reason apiv1alpha1.Reason
+	switch code {
+	case codes.OK:
+		return nil
+	case codes.NotFound:
+		reason = apiv1alpha1.ReasonNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		reason = apiv1alpha1.ReasonConflict
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		reason = apiv1alpha1.ReasonBadRequest
+	case codes.DeadlineExceeded:
+		reason = apiv1alpha1.ReasonTimeout
+	default:
+		reason = apiv1alpha1.ReasonProviderUnavailable
+	}
+
+	return apiv1alpha1.NewError(reason, fmt.Errorf("grpc status %s", code))
+}
+
+// WriteGRPCError writes a trailers-only grpc response with the status.
+func WriteGRPCError(w http.ResponseWriter, code codes.Code, message string) {
+	w.Header().Set("Content-Type", GRPCContentType)
+	w.Header().Set("Grpc-Status", strconv.Itoa(int(code)))
+	w.Header().Set("Grpc-Message", grpcEncodeMessage(message))
+	w.WriteHeader(http.StatusOK)
+}
+
+// grpcEncodeMessage percent-encodes the grpc message as the spec requires.
+func grpcEncodeMessage(message string) string {
+	var b strings.Builder
+	for i := 0; i < len(message); i++ {
+		c := message[i]
+		if c >= ' ' && c <= '~' && c != '%' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,186 @@
+package serviceproxy
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	DeliveryPending = "pending"
+	DeliveryDead    = "dead"
+)
+
+var ErrDeliveryNotFound = errors.New("delivery not found")
+
+var outboxSchema = `
+CREATE TABLE IF NOT EXISTS deliveries (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	watcher    TEXT NOT NULL,
+	op         TEXT NOT NULL,
+	url        TEXT NOT NULL,
+	format     TEXT NOT NULL DEFAULT '',
+	payload    BLOB NOT NULL,
+	attempts   INTEGER NOT NULL DEFAULT 0,
+	state      TEXT NOT NULL,
+	last_error TEXT NOT NULL DEFAULT '',
+	trace_parent TEXT NOT NULL DEFAULT '',
+	created_at INTEGER NOT NULL,
+	updated_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_deliveries_state ON deliveries(state);
+`
+
+// Delivery is a single watcher callback invocation persisted in the outbox.
+type Delivery struct {
+	ID          int64           `db:"id" json:"id"`
+	Watcher     string          `db:"watcher" json:"watcher"`
+	Op          string          `db:"op" json:"op"`
+	URL         string          `db:"url" json:"url"`
+	Format      string          `db:"format" json:"format,omitempty"`
+	Payload     json.RawMessage `db:"payload" json:"payload"`
+	Attempts    int             `db:"attempts" json:"attempts"`
+	State       string          `db:"state" json:"state"`
+	LastError   string          `db:"last_error" json:"lastError,omitempty"`
+	TraceParent string          `db:"trace_parent" json:"traceParent,omitempty"`
+	CreatedAt   int64           `db:"created_at" json:"createdAt"`
+	UpdatedAt   int64           `db:"updated_at" json:"updatedAt"`
+}
+
+// Outbox persists watcher deliveries, so that they survive restarts and failed ones
+// can be inspected and redriven from the dead-letter store.
+type Outbox struct {
+	db *sqlx.DB
+}
+
+// NewOutbox creates the outbox in the dispatcher store.
+func NewOutbox(db *sqlx.DB) (*Outbox, error) {
+	if _, err := db.Exec(outboxSchema); err != nil {
+		return nil, err
+	}
+
+	if err := ensureColumn(db, "deliveries", "format", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return nil, err
+	}
+
+	if err := ensureColumn(db, "deliveries", "trace_parent", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return nil, err
+	}
+
+	return &Outbox{db: db}, nil
+}
+
+// Add persists a new pending delivery and returns its id.
+func (o *Outbox) Add(d *Delivery) (int64, error) {
+	now := time.Now().Unix()
+	res, err := o.db.Exec(`INSERT INTO deliveries (watcher, op, url, format, payload, attempts, state, trace_parent, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, 0, ?, ?, ?, ?)`,
+		d.Watcher, d.Op, d.URL, d.Format, []byte(d.Payload), DeliveryPending, d.TraceParent, now, now)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.LastInsertId()
+}
+
+func (o *Outbox) Get(id int64) (*Delivery, error) {
+	var d Delivery
+	err := o.db.Get(&d, `SELECT * FROM deliveries WHERE id = ?`, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrDeliveryNotFound
+		}
+		return nil, err
+	}
+
+	return &d, nil
+}
+
+// Pending returns the ids and watchers of all deliveries that are not dead yet.
+func (o *Outbox) Pending() ([]*Delivery, error) {
+	deliveries := make([]*Delivery, 0)
+	err := o.db.Select(&deliveries, `SELECT id, watcher FROM deliveries WHERE state = ? ORDER BY id`, DeliveryPending)
+	return deliveries, err
+}
+
+// Delete removes a delivery, either delivered or discarded.
+func (o *Outbox) Delete(id int64) error {
+	res, err := o.db.Exec(`DELETE FROM deliveries WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	return checkAffected(res)
+}
+
+// Failed records a failed attempt and returns the number of attempts so far.
+func (o *Outbox) Failed(id int64, reason string) (int, error) {
+	_, err := o.db.Exec(`UPDATE deliveries SET attempts = attempts + 1, last_error = ?, updated_at = ? WHERE id = ?`,
+		reason, time.Now().Unix(), id)
+	if err != nil {
+		return 0, err
+	}
+
+	var attempts int
+	err = o.db.Get(&attempts, `SELECT attempts FROM deliveries WHERE id = ?`, id)
+	return attempts, err
+}
+
+// Dead moves a delivery to the dead-letter store.
+func (o *Outbox) Dead(id int64) error {
+	return o.setState(id, DeliveryDead, false)
+}
+
+// DeadWatcher moves the pending deliveries of a watcher to the dead-letter store,
+// and returns the number of deliveries moved.
+func (o *Outbox) DeadWatcher(watcher, reason string) (int64, error) {
+	res, err := o.db.Exec(`UPDATE deliveries SET state = ?, last_error = ?, updated_at = ? WHERE watcher = ? AND state = ?`,
+		DeliveryDead, reason, time.Now().Unix(), watcher, DeliveryPending)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+// DeadLetters lists all deliveries in the dead-letter store.
+func (o *Outbox) DeadLetters() ([]*Delivery, error) {
+	deliveries := make([]*Delivery, 0)
+	err := o.db.Select(&deliveries, `SELECT * FROM deliveries WHERE state = ? ORDER BY id`, DeliveryDead)
+	return deliveries, err
+}
+
+// Redrive moves a dead delivery back to pending with its attempts reset.
+func (o *Outbox) Redrive(id int64) error {
+	return o.setState(id, DeliveryPending, true)
+}
+
+func (o *Outbox) setState(id int64, state string, resetAttempts bool) error {
+	query := `UPDATE deliveries SET state = ?, updated_at = ? WHERE id = ?`
+	if resetAttempts {
+		query = `UPDATE deliveries SET state = ?, attempts = 0, updated_at = ? WHERE id = ?`
+	}
+
+	res, err := o.db.Exec(query, state, time.Now().Unix(), id)
+	if err != nil {
+		return err
+	}
+
+	return checkAffected(res)
+}
+
+func checkAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrDeliveryNotFound
+	}
+
+	return nil
+}
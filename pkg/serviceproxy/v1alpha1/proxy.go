@@ -7,7 +7,6 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
@@ -17,16 +16,24 @@ import (
 	sysv1alpha1 "bytetrade.io/web3os/system-server/pkg/apis/sys/v1alpha1"
 	apiv1alpha1 "bytetrade.io/web3os/system-server/pkg/apiserver/v1alpha1/api"
 	"bytetrade.io/web3os/system-server/pkg/constants"
+	"bytetrade.io/web3os/system-server/pkg/metrics"
+	"bytetrade.io/web3os/system-server/pkg/pki"
 	prodiverregistry "bytetrade.io/web3os/system-server/pkg/providerregistry/v1alpha1"
-	"bytetrade.io/web3os/system-server/pkg/utils"
+	"bytetrade.io/web3os/system-server/pkg/tracing"
 
 	"github.com/emicklei/go-restful/v3"
 	"github.com/go-resty/resty/v2"
-	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 	"k8s.io/klog/v2"
 )
 
 var (
+	// SUPPORTED_DATA_TYPE are the well-known data types.
+	//
+	// Deprecated: the data types are whatever the active providers register, see
+	// the discovery api.
 	SUPPORTED_DATA_TYPE = []string{
 		sysv1alpha1.Event,
 		sysv1alpha1.Calendar,
@@ -41,8 +48,18 @@ var (
 	hdrContentEncodingKey = http.CanonicalHeaderKey("Content-Encoding")
 )
 
+// ProxyOptions holds the optional features of Proxy.
+type ProxyOptions struct {
+	// Cache caches the responses of providers with cache TTL.
+	Cache *ResponseCache
+	// Validator validates the requests and responses with the schemas of providers.
+	Validator *SchemaValidator
+}
+
 type Proxy struct {
-	registry *prodiverregistry.Registry
+	registry  *prodiverregistry.Registry
+	cache     *ResponseCache
+	validator *SchemaValidator
 }
 
 // NewProxy constructs a new Proxy.
@@ -54,14 +71,19 @@ func NewProxy(registry *prodiverregistry.Registry) *Proxy {
 	return proxy
 }
 
+// NewProxyWithOptions constructs a new Proxy with the optional features.
+func NewProxyWithOptions(registry *prodiverregistry.Registry, options ProxyOptions) *Proxy {
+	proxy := NewProxy(registry)
+	proxy.cache = options.Cache
+	proxy.validator = options.Validator
+
+	return proxy
+}
+
 // DoRequest send request to provider.
 func (p *Proxy) DoRequest(req *restful.Request, op string, proxyrequest *ProxyRequest) (ret map[string]interface{}, statusCode int, err error) {
 
-	klog.Info("send request to provider: ", utils.PrettyJSON(proxyrequest))
-
-	if !utils.ListContains(SUPPORTED_DATA_TYPE, proxyrequest.DataType) {
-		klog.Warning("unsupported data type, ", proxyrequest.DataType)
-	}
+	klog.Info("send request to provider, ", op, " ", proxyrequest.DataType, ".", proxyrequest.Group, "/", proxyrequest.Version, ", app: ", proxyrequest.AppKey)
 
 	provider, err := p.registry.GetProvider(req.Request.Context(),
 		proxyrequest.DataType,
@@ -70,7 +92,8 @@ func (p *Proxy) DoRequest(req *restful.Request, op string, proxyrequest *ProxyRe
 	)
 
 	if err != nil {
-		return nil, http.StatusInternalServerError, err
+		e := lookupError(err)
+		return nil, e.Status, e
 	}
 
 	authtoken := req.Request.Header.Get(apiv1alpha1.AuthorizationTokenHeader)
@@ -81,37 +104,182 @@ func (p *Proxy) DoRequest(req *restful.Request, op string, proxyrequest *ProxyRe
 			var url string
 			if strings.HasPrefix(provider.Spec.Endpoint, "http://") ||
 				strings.HasPrefix(provider.Spec.Endpoint, "https://") {
-				url = fmt.Sprintf("%s%s", provider.Spec.Endpoint, api.URI)
+				url = fmt.Sprintf("%s%s", provider.Spec.Endpoint, transformPath(&api, requiredOp.Op, proxyrequest))
 			} else {
-				url = fmt.Sprintf("http://%s%s", provider.Spec.Endpoint, api.URI)
+				url = fmt.Sprintf("%s://%s%s", pki.Scheme(), provider.Spec.Endpoint, transformPath(&api, requiredOp.Op, proxyrequest))
 			}
 
 			klog.Info("provider url: ", url)
 
-			client := resty.New()
+			if p.validator != nil && proxyrequest.Data != nil {
+				err = p.validator.Validate(req.Request.Context(), provider, requiredOp.Op, SchemaRequest, proxyrequest.Data)
+				var verr *ValidationError
+				switch {
+				case errors.As(err, &verr):
+					return nil, http.StatusUnprocessableEntity, apiv1alpha1.NewError(apiv1alpha1.ReasonValidationFailed, err).WithDetails(verr)
+				case err != nil:
+					klog.Error("validate request error, ", err)
+					return nil, http.StatusBadGateway, apiv1alpha1.NewError(apiv1alpha1.ReasonProviderUnavailable, err)
+				}
+			}
+
+			var gen uint64
+			cacheable := p.cache != nil && api.CacheTTL.Duration > 0 &&
+				(requiredOp.Op == sysv1alpha1.Get || requiredOp.Op == sysv1alpha1.List)
+			if cacheable {
+				var hit bool
+				if ret, gen, hit = p.cache.Get(op, proxyrequest); hit && !noCache(req.Request) {
+					klog.V(4).Info("response cache hit, ", op, " ", proxyrequest.DataType)
+					return ret, http.StatusOK, nil
+				}
+				ret = nil
+			}
+
+			body, err := transformRequestBody(&api, proxyrequest)
+			if err != nil {
+				return nil, http.StatusBadRequest, apiv1alpha1.NewError(apiv1alpha1.ReasonBadRequest, fmt.Errorf("transform request err: %s", err.Error()))
+			}
+
+			client := newRestyClient()
 
-			resp, err := client.SetTimeout(2*time.Minute).R().
+			var result interface{}
+			proxyReq := client.SetTimeout(2*time.Minute).R().
 				SetHeader(restful.HEADER_ContentType, restful.MIME_JSON).
 				SetHeader(apiv1alpha1.BackendTokenHeader, constants.Nonce).
 				SetHeader(apiv1alpha1.AuthorizationTokenHeader, authtoken).
 				SetHeader(constants.BflUserKey, constants.Owner).
-				SetBody(proxyrequest).
-				SetResult(&ret).
-				Post(url)
+				SetBody(body).
+				SetResult(&result)
+			transformHeaders(&api, proxyReq.Header)
 
+			span := startProviderRequest(req.Request.Context(), provider.Name, requiredOp.Op, url, proxyReq.Header)
+			start := time.Now()
+			resp, err := proxyReq.Execute(transformMethod(&api), url)
 			if err != nil {
-				return nil, http.StatusInternalServerError, fmt.Errorf("invoke provider err: %s", err.Error())
+				e := providerError(apiv1alpha1.ErrorFrom(err), fmt.Errorf("invoke provider err: %w", err))
+				endProviderRequest(span, provider.Name, requiredOp.Op, start, e)
+				return nil, e.Status, e
 			}
 
 			if resp.StatusCode() >= 400 {
-				return nil, resp.StatusCode(), fmt.Errorf("invoke provider err: code %d, %s", resp.StatusCode(), string(resp.Body()))
+				e := providerError(apiv1alpha1.NewErrorWithStatus(resp.StatusCode(), nil),
+					fmt.Errorf("invoke provider err: code %d, %s", resp.StatusCode(), string(resp.Body())))
+				endProviderRequest(span, provider.Name, requiredOp.Op, start, e)
+				return nil, e.Status, e
+			}
+
+			if ret, err = transformResponseBody(&api, result); err != nil {
+				klog.Error("transform provider response error, ", err)
+				e := invalidResponseError(err)
+				endProviderRequest(span, provider.Name, requiredOp.Op, start, e)
+				return nil, http.StatusBadGateway, e
+			}
+
+			if p.validator != nil {
+				err = p.validator.Validate(req.Request.Context(), provider, requiredOp.Op, SchemaResponse, ret)
+				if err != nil {
+					klog.Error("invalid provider response, ", err)
+					e := invalidResponseError(err)
+					endProviderRequest(span, provider.Name, requiredOp.Op, start, e)
+					return nil, http.StatusBadGateway, e
+				}
+			}
+			endProviderRequest(span, provider.Name, requiredOp.Op, start, nil)
+
+			if cacheable {
+				p.cache.Set(op, proxyrequest, gen, ret, api.CacheTTL.Duration)
 			}
 
 			return ret, resp.StatusCode(), nil
 		}
 	}
 
-	return nil, http.StatusNotFound, errors.New("provider not found")
+	return nil, http.StatusNotFound, apiv1alpha1.NewError(apiv1alpha1.ReasonNotFound, errors.New("provider not found"))
+}
+
+// lookupError returns the error of looking up the provider, not_found if there's
+// none.
+func lookupError(err error) *apiv1alpha1.Error {
+	if errors.Is(err, prodiverregistry.ErrProviderNotFound) {
+		return apiv1alpha1.NewError(apiv1alpha1.ReasonNotFound, err)
+	}
+
+	return apiv1alpha1.ErrorFrom(err)
+}
+
+// providerError returns the error of a failed provider call, the provider is
+// unavailable unless e is about the data, not_found, conflict or validation_failed,
+// or a timeout. The other client errors of the provider are of the call from
+// system-server, not of the caller.
+func providerError(e *apiv1alpha1.Error, err error) *apiv1alpha1.Error {
+	switch e.Status {
+	case http.StatusNotFound, http.StatusConflict, http.StatusUnprocessableEntity, http.StatusGatewayTimeout:
+		return &apiv1alpha1.Error{Reason: e.Reason, Status: e.Status, Err: err}
+	}
+
+	return apiv1alpha1.NewError(apiv1alpha1.ReasonProviderUnavailable, err)
+}
+
+// invalidResponseError returns the error of a provider response not as declared,
+// it's not retryable.
+func invalidResponseError(err error) *apiv1alpha1.Error {
+	return &apiv1alpha1.Error{Reason: apiv1alpha1.ReasonInternal, Status: http.StatusBadGateway, Err: err}
+}
+
+// startProviderRequest starts the span of a call to the provider, the trace
+// context is propagated to the provider in header, the headers of the call.
+func startProviderRequest(ctx context.Context, provider, op, url string, header http.Header) trace.Span {
+	ctx, span := tracing.Start(ctx, "provider "+op, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("provider.name", provider),
+			attribute.String("provider.op", op),
+			semconv.URLFull(url),
+		))
+	tracing.Inject(ctx, header)
+
+	return span
+}
+
+// endProviderRequest records a call to the provider and ends its span, the result
+// is success or the reason of err.
+func endProviderRequest(span trace.Span, provider, op string, start time.Time, err error) {
+	result := metrics.ResultSuccess
+	if err != nil {
+		result = string(apiv1alpha1.ErrorFrom(err).Reason)
+	}
+
+	metrics.ProviderRequests.WithLabelValues(provider, op, result).Inc()
+	metrics.ProviderRequestDuration.WithLabelValues(provider, op).Observe(time.Since(start).Seconds())
+
+	span.SetAttributes(attribute.String("result", result))
+	tracing.End(span, err)
+}
+
+// proxiedError returns the error of a call proxied to the provider as is, with
+// the status of the response.
+func proxiedError(resp *resty.Response, err error) error {
+	if err != nil || resp == nil || resp.StatusCode() < 400 {
+		return err
+	}
+
+	return providerError(apiv1alpha1.NewErrorWithStatus(resp.StatusCode(), nil), fmt.Errorf("provider responded %d", resp.StatusCode()))
+}
+
+// newRestyClient returns the client of the upstream calls, with the certificate
+// of system-server if mTLS is enabled.
+func newRestyClient() *resty.Client {
+	client := resty.New()
+	if tlsConfig := pki.ClientTLSConfig(); tlsConfig != nil {
+		client.SetTLSClientConfig(tlsConfig)
+	}
+
+	return client
+}
+
+// noCache returns whether the client asks for a fresh response.
+func noCache(req *http.Request) bool {
+	cc := req.Header.Get("Cache-Control")
+	return strings.Contains(cc, "no-cache") || strings.Contains(cc, "no-store")
 }
 
 func (p *Proxy) ProxyLegacyAPI(ctx context.Context,
@@ -158,7 +326,7 @@ func (p *Proxy) ProxyLegacyAPI(ctx context.Context,
 		strings.HasPrefix(provider.Spec.Endpoint, "https://") {
 		providerURL = fmt.Sprintf("%s/%s", provider.Spec.Endpoint, path)
 	} else {
-		providerURL = fmt.Sprintf("http://%s/%s", provider.Spec.Endpoint, path)
+		providerURL = fmt.Sprintf("%s://%s/%s", pki.Scheme(), provider.Spec.Endpoint, path)
 	}
 
 	klog.Info("provider url: ", providerURL)
@@ -181,33 +349,43 @@ func (p *Proxy) ProxyLegacyAPI(ctx context.Context,
 			}
 
 		}
-		return wsProxy.doWs(req.Request, resp, wsURL)
+		return wsProxy.doWs(req.Request, resp, wsURL, websocketCaller(req.Request, ""))
 	default:
-		dump, err := httputil.DumpRequest(req.Request, true)
+		// never dump the body, it's streamed to the provider
+		dump, err := httputil.DumpRequest(req.Request, false)
 		if err != nil {
 			klog.Error("dump request err: ", err)
 		}
 		klog.Info("orig request: ", string(dump))
 
-		client := resty.New()
-		bodyData, err := ioutil.ReadAll(req.Request.Body)
-		if err != nil {
-			return nil, err
+		client := newRestyClient().SetDoNotParseResponse(true)
+		timeout := 2 * time.Second
+		if hasRequestBody(req) {
+			timeout = LegacyUploadTimeout
 		}
 
-		proxyReq := client.SetTimeout(2*time.Second).R().
+		proxyReq := client.SetTimeout(timeout).R().
 			SetQueryParamsFromValues(req.Request.URL.Query()).
 			SetHeaderMultiValues(req.Request.Header).
 			SetHeader(apiv1alpha1.BackendTokenHeader, constants.Nonce).
-			SetHeader(constants.BflUserKey, constants.Owner).
-			SetBody(bodyData)
+			SetHeader(constants.BflUserKey, constants.Owner)
 
-		return proxyReq.Execute(method, providerURL)
+		if err := setRequestBody(client, proxyReq, req, resp, maxRequestBodySize(provider)); err != nil {
+			return nil, err
+		}
+
+		span := startProviderRequest(ctx, provider.Name, strings.ToLower(method), providerURL, proxyReq.Header)
+		start := time.Now()
+		proxyResp, err := proxyReq.Execute(method, providerURL)
+		endProviderRequest(span, provider.Name, strings.ToLower(method), start, proxiedError(proxyResp, err))
+		return proxyResp, requestBodyError(err)
 	}
 }
 
+// ProxyLegacyAPIV2 proxies the request of the app authenticated by appKey.
 func (p *Proxy) ProxyLegacyAPIV2(ctx context.Context,
 	method string,
+	appKey string,
 	req *restful.Request,
 	resp *restful.Response,
 ) (interface{}, error) {
@@ -232,7 +410,7 @@ func (p *Proxy) ProxyLegacyAPIV2(ctx context.Context,
 		strings.HasPrefix(provider.Spec.Endpoint, "https://") {
 		providerURL = fmt.Sprintf("%s/%s", provider.Spec.Endpoint, path)
 	} else {
-		providerURL = fmt.Sprintf("http://%s/%s", provider.Spec.Endpoint, path)
+		providerURL = fmt.Sprintf("%s://%s/%s", pki.Scheme(), provider.Spec.Endpoint, path)
 	}
 
 	klog.Info("provider url: ", providerURL)
@@ -255,20 +433,19 @@ func (p *Proxy) ProxyLegacyAPIV2(ctx context.Context,
 			}
 
 		}
-		return wsProxy.doWs(req.Request, resp, wsURL)
+		return wsProxy.doWs(req.Request, resp, wsURL, websocketCaller(req.Request, appKey))
 	default:
-		dump, err := httputil.DumpRequest(req.Request, true)
+		// never dump the body, it's streamed to the provider
+		dump, err := httputil.DumpRequest(req.Request, false)
 		if err != nil {
 			klog.Error("dump request err: ", err)
 		}
 		klog.Info("orig request: ", string(dump))
 
-		client := resty.New()
-		bodyData, err := ioutil.ReadAll(req.Request.Body)
-		if err != nil {
-			return nil, err
-		}
+		client := newRestyClient()
+		// the transport replaces the one of the client, keep the tls config of mTLS
 		client.SetTransport(&http.Transport{
+			TLSClientConfig:    pki.ClientTLSConfig(),
 			DisableCompression: true,
 		}).SetDoNotParseResponse(true)
 
@@ -276,187 +453,21 @@ func (p *Proxy) ProxyLegacyAPIV2(ctx context.Context,
 			SetQueryParamsFromValues(req.Request.URL.Query()).
 			SetHeaderMultiValues(req.Request.Header).
 			SetHeader(apiv1alpha1.BackendTokenHeader, constants.Nonce).
-			SetHeader(constants.BflUserKey, constants.Owner).
-			SetBody(bodyData)
-
-		acceptEncoding := req.Request.Header.Get("Accept-Encoding")
-		if strings.Contains(acceptEncoding, "br") {
-			proxyReq.SetHeader("Accept-Encoding", "gzip")
-		}
-
-		return proxyReq.Execute(method, providerURL)
-	}
-}
-
-// websocket proxy
-var (
-	// DefaultUpgrader specifies the parameters for upgrading an HTTP
-	// connection to a WebSocket connection.
-	DefaultUpgrader = &websocket.Upgrader{
-		ReadBufferSize:  1024,
-		WriteBufferSize: 1024,
-	}
-
-	// DefaultDialer is a dialer with all fields set to the default zero values.
-	DefaultDialer = websocket.DefaultDialer
-)
-
-type WebsocketProxy struct {
-	Director func(incoming *http.Request, out http.Header)
-	Upgrader *websocket.Upgrader
-	Dialer   *websocket.Dialer
-}
-
-type WsProxyResponse struct {
-	Request     *resty.Request
-	RawResponse *http.Response
-
-	Body []byte
-}
-
-func NewWsProxy() *WebsocketProxy {
-	return &WebsocketProxy{}
-}
-
-// ServeHTTP implements the http.Handler that proxies WebSocket connections.
-func (w *WebsocketProxy) doWs(req *http.Request, resp *restful.Response, backendURL *url.URL) (*WsProxyResponse, error) {
-	if backendURL == nil {
-		return nil, errors.New(("websocketproxy: backend URL is nil"))
-	}
-
-	dialer := w.Dialer
-	if w.Dialer == nil {
-		dialer = DefaultDialer
-	}
-
-	// Pass headers from the incoming request to the dialer to forward them to
-	// the final destinations.
-	requestHeader := http.Header{}
-	if origin := req.Header.Get("Origin"); origin != "" {
-		requestHeader.Add("Origin", origin)
-	}
-	for _, prot := range req.Header[http.CanonicalHeaderKey("Sec-WebSocket-Protocol")] {
-		requestHeader.Add("Sec-WebSocket-Protocol", prot)
-	}
-	for _, cookie := range req.Header[http.CanonicalHeaderKey("Cookie")] {
-		requestHeader.Add("Cookie", cookie)
-	}
-	if req.Host != "" {
-		requestHeader.Set("Host", req.Host)
-	}
-
-	// Pass X-Forwarded-For headers too, code below is a part of
-	// httputil.ReverseProxy. See http://en.wikipedia.org/wiki/X-Forwarded-For
-	// for more information
-	// TODO: use RFC7239 http://tools.ietf.org/html/rfc7239
-	if clientIP, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
-		// If we aren't the first proxy retain prior
-		// X-Forwarded-For information as a comma+space
-		// separated list and fold multiple headers into one.
-		if prior, ok := req.Header["X-Forwarded-For"]; ok {
-			clientIP = strings.Join(prior, ", ") + ", " + clientIP
-		}
-		requestHeader.Set("X-Forwarded-For", clientIP)
-	}
-
-	// Set the originating protocol of the incoming HTTP request. The SSL might
-	// be terminated on our site and because we doing proxy adding this would
-	// be helpful for applications on the backend.
-	requestHeader.Set("X-Forwarded-Proto", "http")
-	if req.TLS != nil {
-		requestHeader.Set("X-Forwarded-Proto", "https")
-	}
+			SetHeader(constants.BflUserKey, constants.Owner)
 
-	// Enable the director to copy any additional headers it desires for
-	// forwarding to the remote server.
-	if w.Director != nil {
-		w.Director(req, requestHeader)
-	}
-
-	// Connect to the backend URL, also pass the headers we get from the requst
-	// together with the Forwarded headers we prepared above.
-	// TODO: support multiplexing on the same backend connection instead of
-	// opening a new TCP connection time for each request. This should be
-	// optional:
-	// http://tools.ietf.org/html/draft-ietf-hybi-websocket-multiplexing-01
-	wsURL := strings.Replace(backendURL.String(), "http://", "ws://", 1)
-	connBackend, backendResp, err := dialer.Dial(wsURL, requestHeader)
-	if err != nil {
-		klog.Errorf("websocketproxy: couldn't dial to remote backend url %s", err)
-		if backendResp != nil {
-			return toResponse(req, backendResp)
+		if err := setRequestBody(client, proxyReq, req, resp, maxRequestBodySize(provider)); err != nil {
+			return nil, err
 		}
-		return nil, errors.New(http.StatusText(http.StatusServiceUnavailable))
-	}
 
-	upgrader := w.Upgrader
-	if w.Upgrader == nil {
-		upgrader = DefaultUpgrader
-	}
+		// the response is negotiated again for the client, see NegotiateResponseEncoding
+		proxyReq.SetHeader("Accept-Encoding", UpstreamAcceptEncoding(req.Request.Header.Get("Accept-Encoding")))
 
-	// Only pass those headers to the upgrader.
-	upgradeHeader := http.Header{}
-	if hdr := backendResp.Header.Get("Sec-Websocket-Protocol"); hdr != "" {
-		upgradeHeader.Set("Sec-Websocket-Protocol", hdr)
-	}
-	if hdr := backendResp.Header.Get("Set-Cookie"); hdr != "" {
-		upgradeHeader.Set("Set-Cookie", hdr)
-	}
-
-	// Now upgrade the existing incoming request to a WebSocket connection.
-	// Also pass the header that we gathered from the Dial handshake.
-
-	connPub, err := upgrader.Upgrade(resp, req, upgradeHeader)
-	if err != nil {
-		connBackend.Close()
-		return nil, fmt.Errorf("websocketproxy: couldn't upgrade %s", err)
+		span := startProviderRequest(ctx, provider.Name, strings.ToLower(method), providerURL, proxyReq.Header)
+		start := time.Now()
+		proxyResp, err := proxyReq.Execute(method, providerURL)
+		endProviderRequest(span, provider.Name, strings.ToLower(method), start, proxiedError(proxyResp, err))
+		return proxyResp, requestBodyError(err)
 	}
-
-	go func() {
-		defer connPub.Close()
-		defer connBackend.Close()
-
-		errClient := make(chan error, 1)
-		errBackend := make(chan error, 1)
-		replicateWebsocketConn := func(dst, src *websocket.Conn, errc chan error) {
-			for {
-				msgType, msg, err := src.ReadMessage()
-				if err != nil {
-					m := websocket.FormatCloseMessage(websocket.CloseNormalClosure, fmt.Sprintf("%v", err))
-					if e, ok := err.(*websocket.CloseError); ok {
-						if e.Code != websocket.CloseNoStatusReceived {
-							m = websocket.FormatCloseMessage(e.Code, e.Text)
-						}
-					}
-					errc <- err
-					dst.WriteMessage(websocket.CloseMessage, m)
-					break
-				}
-				err = dst.WriteMessage(msgType, msg)
-				if err != nil {
-					errc <- err
-					break
-				}
-			}
-		}
-
-		go replicateWebsocketConn(connPub, connBackend, errClient)
-		go replicateWebsocketConn(connBackend, connPub, errBackend)
-
-		var message string
-		select {
-		case err = <-errClient:
-			message = "websocketproxy: Error when copying from backend to client: %v"
-		case err = <-errBackend:
-			message = "websocketproxy: Error when copying from client to backend: %v"
-
-		}
-		if e, ok := err.(*websocket.CloseError); !ok || e.Code == websocket.CloseAbnormalClosure {
-			klog.Errorf(message, err)
-		}
-	}()
-
-	return nil, nil
 }
 
 func toResponse(req *http.Request, resp *http.Response) (*WsProxyResponse, error) {
@@ -0,0 +1,221 @@
+package serviceproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	sysv1alpha1 "bytetrade.io/web3os/system-server/pkg/apis/sys/v1alpha1"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+const (
+	SchemaRequest  = "request"
+	SchemaResponse = "response"
+
+	// schemaConfigMapTTL is how long the schemas loaded from a ConfigMap are reused.
+	schemaConfigMapTTL = time.Minute
+)
+
+// FieldError is a violation of the schema.
+type FieldError struct {
+	// Path is the json pointer of the invalid field in data, e.g. /attendees/0/email
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// ValidationError is returned if a request or a provider response doesn't match
+// the schema of the op.
+type ValidationError struct {
+	Op     string       `json:"op"`
+	Kind   string       `json:"kind"`
+	Fields []FieldError `json:"fields"`
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", f.Path, f.Message))
+	}
+
+	return fmt.Sprintf("invalid %s of %s, %s", e.Kind, e.Op, strings.Join(msgs, "; "))
+}
+
+// SchemaError is returned if the schema of the op can't be loaded or compiled, it's
+// a fault of the provider, not of the validated data.
+type SchemaError struct {
+	Err error
+}
+
+func (e *SchemaError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *SchemaError) Unwrap() error {
+	return e.Err
+}
+
+type compiledSchema struct {
+	schema  *jsonschema.Schema // nil if not declared
+	err     *SchemaError       // the schema is broken, cached as well
+	expires time.Time          // zero for the inline schemas
+}
+
+// SchemaValidator validates the data of ops against the JSON Schemas declared by the
+// providers, the compiled schemas are cached by the provider's resource version.
+type SchemaValidator struct {
+	kubeClient kubernetes.Interface
+
+	mu       sync.Mutex
+	compiled map[string]*compiledSchema
+}
+
+func NewSchemaValidator(kubeClient kubernetes.Interface) *SchemaValidator {
+	return &SchemaValidator{
+		kubeClient: kubeClient,
+		compiled:   make(map[string]*compiledSchema),
+	}
+}
+
+// Validate validates the value against the schema of op, kind is either SchemaRequest
+// or SchemaResponse. It's valid if the provider declares no schema.
+func (v *SchemaValidator) Validate(ctx context.Context, provider *sysv1alpha1.ProviderRegistry, op, kind string, value interface{}) error {
+	schema, err := v.schemaFor(ctx, provider, op, kind)
+	if err != nil {
+		return err
+	}
+
+	if schema == nil {
+		return nil
+	}
+
+	err = schema.Validate(value)
+	if err == nil {
+		return nil
+	}
+
+	var ve *jsonschema.ValidationError
+	if !errors.As(err, &ve) {
+		return err
+	}
+
+	verr := &ValidationError{Op: op, Kind: kind}
+	for _, e := range ve.BasicOutput().Errors {
+		// the root error only says the value is invalid, the causes follow
+		if e.KeywordLocation == "" {
+			continue
+		}
+
+		path := e.InstanceLocation
+		if path == "" {
+			path = "/"
+		}
+
+		verr.Fields = append(verr.Fields, FieldError{Path: path, Message: e.Error})
+	}
+
+	return verr
+}
+
+func (v *SchemaValidator) schemaFor(ctx context.Context, provider *sysv1alpha1.ProviderRegistry, op, kind string) (*jsonschema.Schema, error) {
+	key := strings.Join([]string{string(provider.UID), provider.ResourceVersion, op, kind}, "/")
+
+	v.mu.Lock()
+	c, ok := v.compiled[key]
+	v.mu.Unlock()
+	if ok && (c.expires.IsZero() || time.Now().Before(c.expires)) {
+		if c.err != nil {
+			return nil, c.err
+		}
+		return c.schema, nil
+	}
+
+	c = &compiledSchema{}
+	source, fromConfigMap, err := v.loadSchema(ctx, provider, op, kind)
+	if err != nil {
+		c.err = &SchemaError{Err: fmt.Errorf("load %s schema of provider %s error, %v", kind, provider.Name, err)}
+	} else if source != "" {
+		url := fmt.Sprintf("%s/%s/%s.%s.json", provider.Namespace, provider.Name, op, kind)
+		if c.schema, err = compileSchema(url, source); err != nil {
+			c.err = &SchemaError{Err: fmt.Errorf("invalid %s schema of provider %s, %v", kind, provider.Name, err)}
+		}
+	}
+
+	// the broken schemas are retried after the ttl, not on every request
+	if fromConfigMap || c.err != nil {
+		c.expires = time.Now().Add(schemaConfigMapTTL)
+	}
+
+	v.mu.Lock()
+	// drop the schemas of the old resource versions
+	prefix := string(provider.UID) + "/"
+	for k := range v.compiled {
+		if strings.HasPrefix(k, prefix) && !strings.HasPrefix(k, prefix+provider.ResourceVersion+"/") {
+			delete(v.compiled, k)
+		}
+	}
+	v.compiled[key] = c
+	v.mu.Unlock()
+
+	if c.err != nil {
+		return nil, c.err
+	}
+	return c.schema, nil
+}
+
+// loadSchema returns the schema source of op, inline in OpApis or in the ConfigMap.
+func (v *SchemaValidator) loadSchema(ctx context.Context, provider *sysv1alpha1.ProviderRegistry, op, kind string) (string, bool, error) {
+	for _, api := range provider.Spec.OpApis {
+		if api.Name != op {
+			continue
+		}
+
+		raw := api.RequestSchema
+		if kind == SchemaResponse {
+			raw = api.ResponseSchema
+		}
+
+		if raw != nil && len(raw.Raw) > 0 {
+			return string(raw.Raw), false, nil
+		}
+	}
+
+	if provider.Spec.SchemaConfigMap == "" || v.kubeClient == nil {
+		return "", false, nil
+	}
+
+	namespace := provider.Spec.Namespace
+	if namespace == "" {
+		namespace = provider.Namespace
+	}
+
+	cm, err := v.kubeClient.CoreV1().ConfigMaps(namespace).Get(ctx, provider.Spec.SchemaConfigMap, metav1.GetOptions{})
+	if err != nil {
+		klog.Error("get schema configmap ", namespace, "/", provider.Spec.SchemaConfigMap, " error, ", err)
+		return "", false, err
+	}
+
+	return cm.Data[op+"."+kind+".json"], true, nil
+}
+
+func compileSchema(url, source string) (*jsonschema.Schema, error) {
+	compiler := jsonschema.NewCompiler()
+	// the schemas are self-contained, never fetch the remote refs
+	compiler.LoadURL = func(s string) (io.ReadCloser, error) {
+		return nil, fmt.Errorf("remote schema ref is not allowed, %s", s)
+	}
+
+	if err := compiler.AddResource(url, strings.NewReader(source)); err != nil {
+		return nil, err
+	}
+
+	return compiler.Compile(url)
+}
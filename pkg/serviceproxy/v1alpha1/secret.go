@@ -0,0 +1,88 @@
+package serviceproxy
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	sysv1alpha1 "bytetrade.io/web3os/system-server/pkg/apis/sys/v1alpha1"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// watcherSecretTTL is how long the secrets of the watchers loaded from the Secrets
+// are reused.
+const watcherSecretTTL = time.Minute
+
+type cachedSecret struct {
+	value   string
+	expires time.Time
+}
+
+// watcherSecrets reads the HMAC secrets of the watchers from the Secrets referenced
+// by their SecretRef.
+type watcherSecrets struct {
+	kubeClient kubernetes.Interface
+
+	mu      sync.Mutex
+	secrets map[string]*cachedSecret
+}
+
+func newWatcherSecrets(kubeClient kubernetes.Interface) *watcherSecrets {
+	return &watcherSecrets{
+		kubeClient: kubeClient,
+		secrets:    make(map[string]*cachedSecret),
+	}
+}
+
+// Get returns the secret of watcher, empty if it has no SecretRef, or the optional
+// Secret is missing.
+func (s *watcherSecrets) Get(ctx context.Context, watcher *sysv1alpha1.ProviderRegistry) (string, error) {
+	ref := watcher.Spec.SecretRef
+	if ref == nil {
+		return "", nil
+	}
+
+	namespace := watcher.Spec.Namespace
+	if namespace == "" {
+		namespace = watcher.Namespace
+	}
+
+	key := namespace + "/" + ref.Name + "/" + ref.Key
+
+	s.mu.Lock()
+	c, ok := s.secrets[key]
+	s.mu.Unlock()
+	if ok && time.Now().Before(c.expires) {
+		return c.value, nil
+	}
+
+	if s.kubeClient == nil {
+		return "", fmt.Errorf("no kube client to read the secret of watcher %s", watcher.Name)
+	}
+
+	optional := ref.Optional != nil && *ref.Optional
+
+	secret, err := s.kubeClient.CoreV1().Secrets(namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	if err != nil && !(optional && apierrors.IsNotFound(err)) {
+		return "", fmt.Errorf("get secret %s/%s of watcher %s error, %v", namespace, ref.Name, watcher.Name, err)
+	}
+
+	var value string
+	if secret != nil && err == nil {
+		data, found := secret.Data[ref.Key]
+		if !found && !optional {
+			return "", fmt.Errorf("key %s not found in secret %s/%s of watcher %s", ref.Key, namespace, ref.Name, watcher.Name)
+		}
+		value = string(data)
+	}
+
+	s.mu.Lock()
+	s.secrets[key] = &cachedSecret{value: value, expires: time.Now().Add(watcherSecretTTL)}
+	s.mu.Unlock()
+
+	return value, nil
+}
@@ -0,0 +1,45 @@
+package serviceproxy
+
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"k8s.io/klog/v2"
+)
+
+// OpenStore opens (or creates) the sqlite store of the dispatcher at path.
+func OpenStore(path string) (*sqlx.DB, error) {
+	db, err := sqlx.Open("sqlite3", path+"?_journal_mode=WAL&_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+
+	// sqlite allows only one writer at a time
+	db.SetMaxOpenConns(1)
+
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	klog.Info("dispatcher store opened, ", path)
+	return db, nil
+}
+
+// ensureColumn adds the column to the table created by an older version.
+func ensureColumn(db *sqlx.DB, table, column, definition string) error {
+	var count int
+	err := db.Get(&count, `SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, table, column)
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return nil
+	}
+
+	klog.Info("migrating store, add column ", table, ".", column)
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
@@ -0,0 +1,177 @@
+package serviceproxy
+
+import (
+	"errors"
+	"sync"
+
+	sysv1alpha1 "bytetrade.io/web3os/system-server/pkg/apis/sys/v1alpha1"
+
+	"k8s.io/klog/v2"
+)
+
+// SubscriptionBufferSize is the number of events buffered for a subscriber, the
+// subscription is closed if a subscriber falls behind by more than that.
+const SubscriptionBufferSize = 128
+
+var ErrSubscriberTooSlow = errors.New("subscriber is too slow, resume from the last cursor")
+
+// Subscription receives the dispatched events of a data type matching its filter,
+// it's the in-process counterpart of a watcher callback for the streaming clients.
+type Subscription struct {
+	DataType string
+	Group    string
+	Version  string
+	AppKey   string
+
+	// Ops are the ops to receive, all ops if empty.
+	Ops []string
+	// Filter has the same semantics as the filters of a watcher callback,
+	// its Op and URI are ignored.
+	Filter sysv1alpha1.Callback
+
+	events chan *DispatchRequest
+	once   sync.Once
+	err    error
+}
+
+// NewSubscription validates the filter and creates a subscription.
+func NewSubscription(dataType, group, version, appKey string, ops []string, filter sysv1alpha1.Callback) (*Subscription, error) {
+	for _, rule := range filter.Rules {
+		if rule.Operator == sysv1alpha1.FilterRegex {
+			for _, v := range rule.Values {
+				if _, err := compileRegexp(v); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	if filter.Expression != "" {
+		if _, err := compileExpression(filter.Expression); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Subscription{
+		DataType: dataType,
+		Group:    group,
+		Version:  version,
+		AppKey:   appKey,
+		Ops:      ops,
+		Filter:   filter,
+		events:   make(chan *DispatchRequest, SubscriptionBufferSize),
+	}, nil
+}
+
+// Events returns the channel of events, it's closed when the subscription is closed.
+func (s *Subscription) Events() <-chan *DispatchRequest {
+	return s.events
+}
+
+// Err returns the reason why the subscription was closed by the server, if any.
+func (s *Subscription) Err() error {
+	return s.err
+}
+
+// Match returns whether the event should be sent to the subscriber.
+func (s *Subscription) Match(req *DispatchRequest) bool {
+	if req.DataType != s.DataType || req.Group != s.Group || req.Version != s.Version {
+		return false
+	}
+
+	if len(s.Ops) > 0 {
+		found := false
+		for _, op := range s.Ops {
+			if op == req.Op {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	ok, err := matchCallback(req, &s.Filter)
+	if err != nil {
+		klog.Error("subscription filter error, ", err)
+		return false
+	}
+
+	return ok
+}
+
+func (s *Subscription) close(err error) {
+	s.once.Do(func() {
+		s.err = err
+		close(s.events)
+	})
+}
+
+// Broadcaster fans out the dispatched events to the subscriptions.
+type Broadcaster struct {
+	mu   sync.RWMutex
+	subs map[*Subscription]struct{}
+}
+
+func NewBroadcaster() *Broadcaster {
+	return &Broadcaster{
+		subs: make(map[*Subscription]struct{}),
+	}
+}
+
+func (b *Broadcaster) Subscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.subs[sub] = struct{}{}
+	klog.Info("subscription added, ", sub.DataType, "/", sub.Group, "/", sub.Version, ", app: ", sub.AppKey)
+}
+
+func (b *Broadcaster) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	delete(b.subs, sub)
+	b.mu.Unlock()
+
+	sub.close(nil)
+}
+
+// Publish sends the event to all matching subscriptions without blocking, a
+// subscriber with full buffer is dropped.
+func (b *Broadcaster) Publish(req *DispatchRequest) {
+	b.mu.RLock()
+	var slow []*Subscription
+	for sub := range b.subs {
+		if !sub.Match(req) {
+			continue
+		}
+
+		select {
+		case sub.events <- req:
+		default:
+			slow = append(slow, sub)
+		}
+	}
+	b.mu.RUnlock()
+
+	for _, sub := range slow {
+		klog.Warning("drop slow subscription, app: ", sub.AppKey)
+		b.mu.Lock()
+		delete(b.subs, sub)
+		b.mu.Unlock()
+
+		sub.close(ErrSubscriberTooSlow)
+	}
+}
+
+// Close closes all the subscriptions, on server shutting down.
+func (b *Broadcaster) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subs {
+		sub.close(nil)
+		delete(b.subs, sub)
+	}
+}
@@ -0,0 +1,182 @@
+package serviceproxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	sysv1alpha1 "bytetrade.io/web3os/system-server/pkg/apis/sys/v1alpha1"
+)
+
+// transformPath returns the uri of the op rewritten by the transform, or the uri
+// of the op if no path is declared.
+func transformPath(api *sysv1alpha1.OpApisItem, op string, req *ProxyRequest) string {
+	if api.Transform == nil || api.Transform.Request == nil || api.Transform.Request.Path == "" {
+		return api.URI
+	}
+
+	replacer := strings.NewReplacer(
+		"{datatype}", req.DataType,
+		"{group}", req.Group,
+		"{version}", req.Version,
+		"{op}", op,
+		"{dataid}", url.PathEscape(dataID(req)),
+	)
+
+	return replacer.Replace(api.Transform.Request.Path)
+}
+
+// transformMethod returns the http method of the op, POST by default.
+func transformMethod(api *sysv1alpha1.OpApisItem) string {
+	if api.Transform == nil || api.Transform.Request == nil || api.Transform.Request.Method == "" {
+		return http.MethodPost
+	}
+
+	return strings.ToUpper(api.Transform.Request.Method)
+}
+
+// transformHeaders applies the header rules of the transform.
+func transformHeaders(api *sysv1alpha1.OpApisItem, header http.Header) {
+	if api.Transform == nil || api.Transform.Request == nil {
+		return
+	}
+
+	for _, h := range api.Transform.Request.RemoveHeaders {
+		header.Del(h)
+	}
+	for h, v := range api.Transform.Request.SetHeaders {
+		header.Set(h, v)
+	}
+}
+
+// transformRequestBody returns the body sent to the provider, the ProxyRequest
+// envelope as is if no body rules are declared.
+func transformRequestBody(api *sysv1alpha1.OpApisItem, req *ProxyRequest) (interface{}, error) {
+	if api.Transform == nil || api.Transform.Request == nil || isEmptyBodyTransform(&api.Transform.Request.BodyTransform) {
+		return req, nil
+	}
+
+	body, err := toJSONValue(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return transformBody(&api.Transform.Request.BodyTransform, body)
+}
+
+// transformResponseBody returns the response of the op from the provider response.
+func transformResponseBody(api *sysv1alpha1.OpApisItem, body interface{}) (map[string]interface{}, error) {
+	if api.Transform != nil && api.Transform.Response != nil {
+		var err error
+		if body, err = transformBody(api.Transform.Response, body); err != nil {
+			return nil, err
+		}
+	}
+
+	if body == nil {
+		return nil, nil
+	}
+
+	ret, ok := body.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("provider response is %T, not an object, wrap it with the response transform", body)
+	}
+
+	return ret, nil
+}
+
+func isEmptyBodyTransform(t *sysv1alpha1.BodyTransform) bool {
+	return t.Unwrap == "" && len(t.Rename) == 0 && t.Wrap == ""
+}
+
+// transformBody applies the rules in the order of unwrap, rename and wrap.
+func transformBody(t *sysv1alpha1.BodyTransform, body interface{}) (interface{}, error) {
+	if t.Unwrap != "" {
+		value, ok := lookupPath(body, t.Unwrap)
+		if !ok {
+			return nil, fmt.Errorf("field %s to unwrap not found", t.Unwrap)
+		}
+		body = value
+	}
+
+	for _, rule := range t.Rename {
+		renameField(body, strings.Split(rule.From, "."), rule.To)
+	}
+
+	if t.Wrap != "" {
+		body = map[string]interface{}{t.Wrap: body}
+	}
+
+	return body, nil
+}
+
+// lookupPath returns the value at the dotted path.
+func lookupPath(value interface{}, path string) (interface{}, bool) {
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+
+		if value, ok = obj[key]; !ok {
+			return nil, false
+		}
+	}
+
+	return value, true
+}
+
+// renameField renames the last field of path to name, * in path matches every
+// element of arrays and objects.
+func renameField(value interface{}, path []string, name string) {
+	if len(path) == 0 {
+		return
+	}
+
+	key := path[0]
+	if key == "*" {
+		switch v := value.(type) {
+		case []interface{}:
+			for _, e := range v {
+				renameField(e, path[1:], name)
+			}
+		case map[string]interface{}:
+			for _, e := range v {
+				renameField(e, path[1:], name)
+			}
+		}
+		return
+	}
+
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	if len(path) > 1 {
+		renameField(obj[key], path[1:], name)
+		return
+	}
+
+	if v, ok := obj[key]; ok && key != name {
+		obj[name] = v
+		delete(obj, key)
+	}
+}
+
+// dataID returns the data id param of the request, if any.
+func dataID(req *ProxyRequest) string {
+	switch p := req.Param.(type) {
+	case UpdateOpParam:
+		return p.DataID
+	case *UpdateOpParam:
+		return p.DataID
+	case GetOpParam:
+		return p.DataID
+	case *GetOpParam:
+		return p.DataID
+	}
+
+	return ""
+}
@@ -1,13 +1,16 @@
 package serviceproxy
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/url"
 	"strconv"
+	"time"
 
 	sysv1alpha1 "bytetrade.io/web3os/system-server/pkg/apis/sys/v1alpha1"
 	"bytetrade.io/web3os/system-server/pkg/apiserver/v1alpha1/api"
 
 	"github.com/emicklei/go-restful/v3"
-	"k8s.io/klog/v2"
 )
 
 const (
@@ -24,7 +27,9 @@ type ProxyRequest struct {
 	AppKey   string      `json:"appkey"`
 	Param    interface{} `json:"param,omitempty"`
 	Data     interface{} `json:"data,omitempty"`
-	Token    string
+	// Token is the access token of the caller, sent to the provider only, it's
+	// cleared from the events.
+	Token string `json:"Token,omitempty"`
 }
 
 type GetOpParam struct {
@@ -39,6 +44,92 @@ type ListOpParam struct {
 type Pagination struct {
 	Offset int `json:"offset,omitempty"`
 	Limit  int `json:"limit"`
+	// Continue is the cursor returned by the provider as next of the last page,
+	// it's opaque to system-server and preferred over Offset.
+	Continue string `json:"continue,omitempty"`
+}
+
+// the query parameters of List op, the others are filters
+const (
+	QueryOffset   = "offset"
+	QueryLimit    = "limit"
+	QueryContinue = "continue"
+)
+
+// the keys of the page fields in the List result of provider
+const (
+	ListResultNext     = "next"
+	ListResultContinue = "continue"
+	ListResultTotal    = "total"
+)
+
+// ListPage is the page of a List result.
+type ListPage struct {
+	// Continue is the cursor to get the next page, empty on the last page.
+	Continue string `json:"continue,omitempty"`
+	// Total is the number of all items, if the provider counts them.
+	Total *int64 `json:"total,omitempty"`
+}
+
+func newListOpParam(q url.Values) (ListOpParam, error) {
+	filters := make(map[string][]string)
+	for k, v := range q {
+		if k != QueryOffset && k != QueryLimit && k != QueryContinue {
+			filters[k] = v
+		}
+	}
+
+	listParam := ListOpParam{
+		Filters: filters,
+	}
+
+	if l := q.Get(QueryLimit); l != "" {
+		limit, err := strconv.Atoi(l)
+		if err != nil || limit < 0 {
+			return listParam, fmt.Errorf("invalid limit %q", l)
+		}
+		listParam.Page.Limit = limit
+	}
+
+	if o := q.Get(QueryOffset); o != "" {
+		offset, err := strconv.Atoi(o)
+		if err != nil || offset < 0 {
+			return listParam, fmt.Errorf("invalid offset %q", o)
+		}
+		listParam.Page.Offset = offset
+	}
+
+	listParam.Page.Continue = q.Get(QueryContinue)
+
+	return listParam, nil
+}
+
+// NewListPage picks the page fields from the List result of provider, the next
+// cursor is either "next" or "continue", and the total is a number.
+func NewListPage(ret map[string]interface{}) *ListPage {
+	var page ListPage
+	for _, key := range []string{ListResultNext, ListResultContinue} {
+		if next, ok := ret[key].(string); ok && next != "" {
+			page.Continue = next
+			break
+		}
+	}
+
+	switch total := ret[ListResultTotal].(type) {
+	case float64:
+		t := int64(total)
+		page.Total = &t
+	case json.Number:
+		if t, err := total.Int64(); err == nil {
+			page.Total = &t
+		}
+	}
+
+	if page.Continue == "" && page.Total == nil {
+		return nil
+	}
+
+	return &page
 }
 
 type UpdateOpParam struct {
@@ -48,6 +139,13 @@ type UpdateOpParam struct {
 type DispatchRequest struct {
 	ProxyRequest
 	Result interface{} `json:"result"`
+	// Cursor is the position of the request in the event log.
+	Cursor int64 `json:"cursor,omitempty"`
+
+	// ID and Time identify the event in CloudEvents format, they are not part
+	// of the legacy format.
+	ID   string    `json:"-"`
+	Time time.Time `json:"-"`
 }
 
 // NewProxyRequestFromOpRequest constructs a new ProxyRequest.
@@ -67,35 +165,11 @@ func NewProxyRequestFromOpRequest(appkey, op string, req *restful.Request) (*Pro
 		}
 
 	case sysv1alpha1.List:
-		q := req.Request.URL.Query()
-		filters := make(map[string][]string)
-
-		for k, v := range q {
-			if k != "offset" && k != "limit" {
-				filters[k] = v
-			}
-		}
-
-		listParam := ListOpParam{
-			Filters: filters,
+		listParam, err := newListOpParam(req.Request.URL.Query())
+		if err != nil {
+			return nil, err
 		}
 
-		l, ok := q["limit"]
-		if ok && len(l) > 0 {
-			limit, err := strconv.Atoi(l[0])
-			if err != nil {
-				klog.Error("query param limit is invalid numeric string, ", l[0])
-			} else {
-				listParam.Page.Limit = limit
-				if o, ok := q["offset"]; ok {
-					if offset, err := strconv.Atoi(o[0]); err != nil {
-						listParam.Page.Offset = offset
-					}
-				}
-			}
-
-		} // end if page param
-
 		param = listParam
 
 	default:
@@ -129,7 +203,7 @@ func NewProxyRequestFromOpRequest(appkey, op string, req *restful.Request) (*Pro
 // NewDispatchRequest constructs a new DispatchRequest object.
 func NewDispatchRequest(pr *ProxyRequest, result any) *DispatchRequest {
 	return &DispatchRequest{
-		*pr,
-		result,
+		ProxyRequest: *pr,
+		Result:       result,
 	}
 }
@@ -0,0 +1,499 @@
+package serviceproxy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"bytetrade.io/web3os/system-server/pkg/constants"
+	"bytetrade.io/web3os/system-server/pkg/metrics"
+	"bytetrade.io/web3os/system-server/pkg/pki"
+	"bytetrade.io/web3os/system-server/pkg/tracing"
+	"bytetrade.io/web3os/system-server/pkg/utils"
+
+	"github.com/emicklei/go-restful/v3"
+	"github.com/go-resty/resty/v2"
+	"github.com/gorilla/websocket"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/klog/v2"
+)
+
+const (
+	DefaultWebsocketPingPeriod      = 30 * time.Second
+	DefaultWebsocketIdleTimeout     = 30 * time.Minute
+	DefaultWebsocketMaxMessageSize  = 32 << 20
+	DefaultWebsocketMaxConnsPerUser = 256
+
+	// websocketWriteWait is the time allowed to write a message or a control frame.
+	websocketWriteWait = 10 * time.Second
+)
+
+// websocket proxy
+var (
+	// DefaultUpgrader specifies the parameters for upgrading an HTTP
+	// connection to a WebSocket connection.
+	DefaultUpgrader = &websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+	}
+
+	// DefaultDialer is a dialer with all fields set to the default zero values.
+	DefaultDialer = websocket.DefaultDialer
+
+	ErrTooManyWebsockets = errors.New("too many websocket connections")
+
+	// websockets are the proxied connections of all proxies, the per-caller caps
+	// and the shutdown apply to all of them.
+	websockets = newWebsocketSessions()
+)
+
+type WebsocketProxy struct {
+	Director func(incoming *http.Request, out http.Header)
+	Upgrader *websocket.Upgrader
+	Dialer   *websocket.Dialer
+
+	// PingPeriod is the period of pings sent to both peers, a peer not answering
+	// in 2 periods is closed.
+	PingPeriod time.Duration
+	// IdleTimeout closes the connections without messages in either direction.
+	IdleTimeout time.Duration
+	// MaxMessageSize is the max size of a message read from either peer.
+	MaxMessageSize int64
+	// MaxConnsPerUser is the max number of proxied connections of a caller, the
+	// app authenticated by its key, or the client address of the unauthenticated.
+	MaxConnsPerUser int
+}
+
+type WsProxyResponse struct {
+	Request     *resty.Request
+	RawResponse *http.Response
+
+	Body []byte
+}
+
+// NewWsProxy constructs a WebsocketProxy configured by the environment.
+func NewWsProxy() *WebsocketProxy {
+	w := &WebsocketProxy{
+		PingPeriod:      constants.WebsocketPingPeriod,
+		IdleTimeout:     constants.WebsocketIdleTimeout,
+		MaxMessageSize:  constants.WebsocketMaxMessageSize,
+		MaxConnsPerUser: constants.WebsocketMaxConnsPerUser,
+	}
+
+	if w.PingPeriod <= 0 {
+		w.PingPeriod = DefaultWebsocketPingPeriod
+	}
+	if w.IdleTimeout <= 0 {
+		w.IdleTimeout = DefaultWebsocketIdleTimeout
+	}
+	if w.MaxMessageSize <= 0 {
+		w.MaxMessageSize = DefaultWebsocketMaxMessageSize
+	}
+	if w.MaxConnsPerUser <= 0 {
+		w.MaxConnsPerUser = DefaultWebsocketMaxConnsPerUser
+	}
+
+	return w
+}
+
+// CloseWebsockets closes all the proxied websocket connections with a going away
+// close frame, it's called on server shutdown since http.Server.Shutdown never
+// closes the hijacked connections.
+func CloseWebsockets() {
+	websockets.closeAll()
+}
+
+// websocketURL returns the websocket url of the backend, wss for https.
+func websocketURL(backendURL *url.URL) *url.URL {
+	u := *backendURL
+	switch u.Scheme {
+	case "https":
+		u.Scheme = "wss"
+	case "http", "":
+		u.Scheme = "ws"
+	}
+
+	return &u
+}
+
+// websocketCaller returns the caller the connection counts for, the app key if
+// the caller is authenticated, the client address otherwise. Behind the ingress
+// the remote address is the ingress's own, the client address is the one the
+// ingress sets in X-Real-IP, or appends last to X-Forwarded-For. The headers set
+// by the client, e.g. X-BFL-USER or the first hops of X-Forwarded-For, are never
+// trusted.
+func websocketCaller(req *http.Request, appKey string) string {
+	if appKey != "" {
+		return "app:" + appKey
+	}
+
+	if ip := strings.TrimSpace(req.Header.Get(utils.XRealIP)); ip != "" {
+		return "addr:" + ip
+	}
+
+	if hops := req.Header.Values(utils.XForwardedFor); len(hops) > 0 {
+		last := hops[len(hops)-1]
+		if i := strings.LastIndex(last, ","); i >= 0 {
+			last = last[i+1:]
+		}
+
+		if ip := strings.TrimSpace(last); ip != "" {
+			return "addr:" + ip
+		}
+	}
+
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+
+	return "addr:" + host
+}
+
+// ServeHTTP implements the http.Handler that proxies WebSocket connections.
+// The connection counts for the caller, see websocketCaller.
+func (w *WebsocketProxy) doWs(req *http.Request, resp *restful.Response, backendURL *url.URL, caller string) (*WsProxyResponse, error) {
+	if backendURL == nil {
+		return nil, errors.New(("websocketproxy: backend URL is nil"))
+	}
+
+	if !websockets.acquire(caller, w.MaxConnsPerUser) {
+		klog.Warning("websocketproxy: too many connections of caller ", caller)
+		return &WsProxyResponse{
+			RawResponse: &http.Response{StatusCode: http.StatusTooManyRequests},
+			Body:        []byte(ErrTooManyWebsockets.Error()),
+		}, nil
+	}
+
+	// released by the session once upgraded
+	upgraded := false
+	defer func() {
+		if !upgraded {
+			websockets.release(caller)
+		}
+	}()
+
+	dialer := w.Dialer
+	if w.Dialer == nil {
+		dialer = DefaultDialer
+	}
+	if tlsConfig := pki.ClientTLSConfig(); tlsConfig != nil && dialer.TLSClientConfig == nil {
+		// wss with the certificate of system-server
+		d := *dialer
+		d.TLSClientConfig = tlsConfig
+		dialer = &d
+	}
+
+	// Pass headers from the incoming request to the dialer to forward them to
+	// the final destinations.
+	requestHeader := http.Header{}
+	if origin := req.Header.Get("Origin"); origin != "" {
+		requestHeader.Add("Origin", origin)
+	}
+	for _, prot := range req.Header[http.CanonicalHeaderKey("Sec-WebSocket-Protocol")] {
+		requestHeader.Add("Sec-WebSocket-Protocol", prot)
+	}
+	for _, cookie := range req.Header[http.CanonicalHeaderKey("Cookie")] {
+		requestHeader.Add("Cookie", cookie)
+	}
+	if req.Host != "" {
+		requestHeader.Set("Host", req.Host)
+	}
+
+	// Pass X-Forwarded-For headers too, code below is a part of
+	// httputil.ReverseProxy. See http://en.wikipedia.org/wiki/X-Forwarded-For
+	// for more information
+	// TODO: use RFC7239 http://tools.ietf.org/html/rfc7239
+	if clientIP, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		// If we aren't the first proxy retain prior
+		// X-Forwarded-For information as a comma+space
+		// separated list and fold multiple headers into one.
+		if prior, ok := req.Header["X-Forwarded-For"]; ok {
+			clientIP = strings.Join(prior, ", ") + ", " + clientIP
+		}
+		requestHeader.Set("X-Forwarded-For", clientIP)
+	}
+
+	// Set the originating protocol of the incoming HTTP request. The SSL might
+	// be terminated on our site and because we doing proxy adding this would
+	// be helpful for applications on the backend.
+	requestHeader.Set("X-Forwarded-Proto", "http")
+	if req.TLS != nil {
+		requestHeader.Set("X-Forwarded-Proto", "https")
+	}
+
+	// Enable the director to copy any additional headers it desires for
+	// forwarding to the remote server.
+	if w.Director != nil {
+		w.Director(req, requestHeader)
+	}
+
+	// Connect to the backend URL, also pass the headers we get from the requst
+	// together with the Forwarded headers we prepared above. Every client gets
+	// its own backend connection, the multiplexing extension of websocket was
+	// never standardized, and the backends can't demultiplex the messages anyway.
+	wsURL := websocketURL(backendURL).String()
+	ctx, span := tracing.Start(req.Context(), "websocket setup", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.URLFull(wsURL)))
+	tracing.Inject(ctx, requestHeader)
+
+	connBackend, backendResp, err := dialer.DialContext(req.Context(), wsURL, requestHeader)
+	if err != nil {
+		klog.Errorf("websocketproxy: couldn't dial to remote backend url %s", err)
+		tracing.End(span, err)
+		if backendResp != nil {
+			return toResponse(req, backendResp)
+		}
+		return nil, errors.New(http.StatusText(http.StatusServiceUnavailable))
+	}
+
+	upgrader := w.Upgrader
+	if w.Upgrader == nil {
+		upgrader = DefaultUpgrader
+	}
+
+	// Only pass those headers to the upgrader.
+	upgradeHeader := http.Header{}
+	if hdr := backendResp.Header.Get("Sec-Websocket-Protocol"); hdr != "" {
+		upgradeHeader.Set("Sec-Websocket-Protocol", hdr)
+	}
+	if hdr := backendResp.Header.Get("Set-Cookie"); hdr != "" {
+		upgradeHeader.Set("Set-Cookie", hdr)
+	}
+
+	// Now upgrade the existing incoming request to a WebSocket connection.
+	// Also pass the header that we gathered from the Dial handshake.
+
+	connPub, err := upgrader.Upgrade(resp, req, upgradeHeader)
+	if err != nil {
+		connBackend.Close()
+		tracing.End(span, err)
+		return nil, fmt.Errorf("websocketproxy: couldn't upgrade %s", err)
+	}
+
+	upgraded = true
+	session := &websocketSession{
+		user:        caller,
+		client:      connPub,
+		backend:     connBackend,
+		pingPeriod:  w.PingPeriod,
+		idleTimeout: w.IdleTimeout,
+		closed:      make(chan struct{}),
+	}
+	session.lastActive.Store(time.Now().UnixNano())
+
+	for _, conn := range []*websocket.Conn{connPub, connBackend} {
+		conn.SetReadLimit(w.MaxMessageSize)
+	}
+
+	websockets.add(session)
+	span.End()
+	go session.run()
+
+	return nil, nil
+}
+
+// websocketSession is a proxied connection, the messages are copied between the
+// client and the backend while both of them are alive.
+type websocketSession struct {
+	user        string
+	client      *websocket.Conn
+	backend     *websocket.Conn
+	pingPeriod  time.Duration
+	idleTimeout time.Duration
+
+	lastActive atomic.Int64 // unix nano of the last message in either direction
+	closeOnce  sync.Once
+	closed     chan struct{}
+}
+
+func (s *websocketSession) run() {
+	defer func() {
+		s.close(websocket.CloseNormalClosure, "")
+		websockets.remove(s)
+	}()
+
+	errClient := make(chan error, 1)
+	errBackend := make(chan error, 1)
+
+	go s.replicate(s.client, s.backend, errClient)
+	go s.replicate(s.backend, s.client, errBackend)
+
+	ticker := time.NewTicker(s.pingPeriod)
+	defer ticker.Stop()
+
+	var (
+		err     error
+		message string
+	)
+	for {
+		select {
+		case err = <-errClient:
+			message = "websocketproxy: Error when copying from backend to client: %v"
+		case err = <-errBackend:
+			message = "websocketproxy: Error when copying from client to backend: %v"
+		case <-s.closed:
+			return
+
+		case <-ticker.C:
+			last := time.Unix(0, s.lastActive.Load())
+			if time.Since(last) > s.idleTimeout {
+				klog.Info("websocketproxy: close idle connection of user ", s.user)
+				s.close(websocket.CloseGoingAway, "idle timeout")
+				return
+			}
+
+			deadline := time.Now().Add(websocketWriteWait)
+			for _, conn := range []*websocket.Conn{s.client, s.backend} {
+				if err := conn.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+					klog.V(4).Info("websocketproxy: ping error, ", err)
+					return
+				}
+			}
+			continue
+		}
+
+		select {
+		case <-s.closed:
+			// closed by the idle timeout or the shutdown
+		default:
+			if e, ok := err.(*websocket.CloseError); !ok || e.Code == websocket.CloseAbnormalClosure {
+				klog.Errorf(message, err)
+			}
+		}
+		return
+	}
+}
+
+// replicate copies the messages from src to dst, until src is closed or silent in
+// 2 ping periods.
+func (s *websocketSession) replicate(dst, src *websocket.Conn, errc chan error) {
+	pongWait := 2 * s.pingPeriod
+	src.SetReadDeadline(time.Now().Add(pongWait))
+	src.SetPongHandler(func(string) error {
+		return src.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		msgType, msg, err := src.ReadMessage()
+		if err != nil {
+			m := websocket.FormatCloseMessage(websocket.CloseNormalClosure, fmt.Sprintf("%v", err))
+			if e, ok := err.(*websocket.CloseError); ok {
+				if e.Code != websocket.CloseNoStatusReceived {
+					m = websocket.FormatCloseMessage(e.Code, e.Text)
+				}
+			} else if errors.Is(err, websocket.ErrReadLimit) {
+				m = websocket.FormatCloseMessage(websocket.CloseMessageTooBig, "message too big")
+				src.WriteControl(websocket.CloseMessage, m, time.Now().Add(websocketWriteWait))
+			}
+			errc <- err
+			dst.WriteControl(websocket.CloseMessage, m, time.Now().Add(websocketWriteWait))
+			return
+		}
+
+		s.lastActive.Store(time.Now().UnixNano())
+		src.SetReadDeadline(time.Now().Add(pongWait))
+
+		dst.SetWriteDeadline(time.Now().Add(websocketWriteWait))
+		if err = dst.WriteMessage(msgType, msg); err != nil {
+			errc <- err
+			return
+		}
+	}
+}
+
+// close sends the close frame to both peers and closes the connections, the
+// replicating goroutines return on the closed connections.
+func (s *websocketSession) close(code int, text string) {
+	s.closeOnce.Do(func() {
+		deadline := time.Now().Add(websocketWriteWait)
+		m := websocket.FormatCloseMessage(code, text)
+		for _, conn := range []*websocket.Conn{s.client, s.backend} {
+			conn.WriteControl(websocket.CloseMessage, m, deadline)
+			conn.Close()
+		}
+		close(s.closed)
+	})
+}
+
+type websocketSessions struct {
+	mu       sync.Mutex
+	sessions map[*websocketSession]struct{}
+	users    map[string]int
+}
+
+func newWebsocketSessions() *websocketSessions {
+	return &websocketSessions{
+		sessions: make(map[*websocketSession]struct{}),
+		users:    make(map[string]int),
+	}
+}
+
+// acquire counts a connection of user, returns false if the user has max connections.
+func (w *websocketSessions) acquire(user string, max int) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.users[user] >= max {
+		return false
+	}
+
+	w.users[user]++
+	return true
+}
+
+func (w *websocketSessions) release(user string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.releaseLocked(user)
+}
+
+func (w *websocketSessions) releaseLocked(user string) {
+	if w.users[user] <= 1 {
+		delete(w.users, user)
+		return
+	}
+
+	w.users[user]--
+}
+
+func (w *websocketSessions) add(s *websocketSession) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.sessions[s] = struct{}{}
+	metrics.WebsocketConnections.WithLabelValues("proxy").Inc()
+}
+
+func (w *websocketSessions) remove(s *websocketSession) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, ok := w.sessions[s]; ok {
+		delete(w.sessions, s)
+		w.releaseLocked(s.user)
+		metrics.WebsocketConnections.WithLabelValues("proxy").Dec()
+	}
+}
+
+func (w *websocketSessions) closeAll() {
+	w.mu.Lock()
+	sessions := make([]*websocketSession, 0, len(w.sessions))
+	for s := range w.sessions {
+		sessions = append(sessions, s)
+	}
+	w.mu.Unlock()
+
+	klog.Info("websocketproxy: close ", len(sessions), " connections on shutdown")
+	for _, s := range sessions {
+		s.close(websocket.CloseGoingAway, "server shutdown")
+	}
+}
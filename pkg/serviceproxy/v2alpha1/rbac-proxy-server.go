@@ -7,8 +7,12 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
+	"bytetrade.io/web3os/system-server/pkg/metrics"
 	permv2alpha1 "bytetrade.io/web3os/system-server/pkg/permission/v2alpha1"
+	"bytetrade.io/web3os/system-server/pkg/pki"
+	"bytetrade.io/web3os/system-server/pkg/tracing"
 	"bytetrade.io/web3os/system-server/pkg/utils"
 	"github.com/brancz/kube-rbac-proxy/cmd/kube-rbac-proxy/app/options"
 	"github.com/brancz/kube-rbac-proxy/pkg/authn"
@@ -17,6 +21,10 @@ import (
 	"github.com/brancz/kube-rbac-proxy/pkg/proxy"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 	"k8s.io/apiserver/pkg/authentication/authenticator"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
@@ -32,6 +40,7 @@ type server struct {
 	mainCtx       context.Context
 	authenticator authenticator.Request
 	authorizer    permv2alpha1.Authorizer
+	explainer     *permv2alpha1.Explainer
 }
 
 // AddTarget implements middleware.ProxyBalancer.
@@ -46,12 +55,12 @@ func (s *server) Next(ctx echo.Context) *middleware.ProxyTarget {
 			klog.V(5).Infof("RBAC: using provider service %q", svcStr)
 			var proxyPassStr string
 			// if the service string is like "http://service.namespace.svc:port" or "https://service.namespace.svc:port"
-			// we use it directly, otherwise we add "http://" prefix
+			// we use it directly, otherwise we add "http://" prefix, or "https://" if mTLS is enabled
 			if strings.HasPrefix(svcStr, "http://") || strings.HasPrefix(svcStr, "https://") {
 				proxyPassStr = svcStr
 			} else {
 				// otherwise we assume it is like "service.namespace.svc:port"
-				proxyPassStr = fmt.Sprintf("http://%s", svcStr)
+				proxyPassStr = fmt.Sprintf("%s://%s", pki.Scheme(), svcStr)
 			}
 
 			proxyPass, err := url.Parse(proxyPassStr)
@@ -76,6 +85,8 @@ func NewRBACProxyServer(ctx context.Context) *server {
 	proxy := echo.New()
 	proxy.Use(middleware.Recover())
 	proxy.Use(middleware.Logger())
+	proxy.Use(recordMetrics)
+	proxy.Use(traceRequest)
 
 	s := &server{
 		mainCtx: ctx,
@@ -107,6 +118,7 @@ func (s *server) Init(cfg *completedProxyRunOptions) error {
 		return err
 	}
 
+	s.explainer = permv2alpha1.NewExplainer(s.authenticator, s.authorizer, cfg.auth.Authorization)
 	s.proxy.Use(s.rbac(cfg))
 
 	config := middleware.DefaultProxyConfig
@@ -126,6 +138,18 @@ func (s *server) Init(cfg *completedProxyRunOptions) error {
 	}
 	s.proxy.Use(middleware.ProxyWithConfig(config))
 
+	// proxy for websocket over mTLS, the raw connections are dialed with tls if the
+	// transport has a tls config
+	if tlsConfig := pki.ClientTLSConfig(); tlsConfig != nil {
+		tlsWebsocketConfig := config
+		tlsWebsocketConfig.Skipper = func(c echo.Context) bool {
+			target := s.Next(c)
+			return target == nil || target.URL.Scheme != "https"
+		}
+		tlsWebsocketConfig.Transport = &http.Transport{TLSClientConfig: tlsConfig}
+		s.proxy.Use(middleware.ProxyWithConfig(tlsWebsocketConfig))
+	}
+
 	// proxy for websocket
 	websocketConfig := config
 	websocketTransport, err := initTransport(cfg.upstreamCABundle, cfg.tls.UpstreamClientCertFile, cfg.tls.UpstreamClientKeyFile)
@@ -181,10 +205,70 @@ func (s *server) rbac(cfg *completedProxyRunOptions) func(next echo.HandlerFunc)
 	}
 }
 
+// recordMetrics records the requests by the provider service, the service is
+// empty if the request is denied.
+func recordMetrics(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		start := time.Now()
+		err := next(c)
+
+		code := c.Response().Status
+		if err != nil {
+			// the error is written by the error handler of echo later
+			code = http.StatusInternalServerError
+			if he, ok := err.(*echo.HTTPError); ok {
+				code = he.Code
+			}
+		}
+
+		service, _ := c.Get(serviceKey).(string)
+		metrics.RBACProxyRequests.WithLabelValues(service, c.Request().Method, strconv.Itoa(code)).Inc()
+		metrics.RBACProxyRequestDuration.WithLabelValues(service).Observe(time.Since(start).Seconds())
+
+		return err
+	}
+}
+
+// traceRequest starts the server span of the request, the trace context of the
+// span is propagated to the provider in the headers of the proxied request.
+func traceRequest(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx := tracing.Extract(req.Context(), req.Header)
+		ctx, span := tracing.Start(ctx, "rbac proxy "+req.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(req.Method),
+				semconv.URLPath(req.URL.Path),
+				semconv.ServerAddress(req.Host),
+			))
+		defer span.End()
+
+		tracing.Inject(ctx, req.Header)
+		c.SetRequest(req.WithContext(ctx))
+
+		err := next(c)
+
+		service, _ := c.Get(serviceKey).(string)
+		span.SetAttributes(attribute.String("provider.service", service), semconv.HTTPResponseStatusCode(c.Response().Status))
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+
+		return err
+	}
+}
+
 func (s *server) Authenticator() authenticator.Request {
 	return s.authenticator
 }
 
+// Explainer explains the decisions of the proxy, it's nil before Init.
+func (s *server) Explainer() *permv2alpha1.Explainer {
+	return s.explainer
+}
+
 func ServerOptions(listenAddress string) *completedProxyRunOptions {
 	completed := &completedProxyRunOptions{
 		insecureListenAddress: listenAddress,
@@ -7,6 +7,8 @@ import (
 	"net"
 	"net/http"
 	"time"
+
+	"bytetrade.io/web3os/system-server/pkg/pki"
 )
 
 func initTransport(upstreamCAPool *x509.CertPool, upstreamClientCertPath, upstreamClientKeyPath string) (http.RoundTripper, error) {
@@ -25,6 +27,11 @@ func initTransport(upstreamCAPool *x509.CertPool, upstreamClientCertPath, upstre
 	}
 
 	if upstreamCAPool == nil {
+		// the providers are verified by the internal CA if mTLS is enabled
+		if tlsConfig := pki.ClientTLSConfig(); tlsConfig != nil {
+			transport.TLSHandshakeTimeout = 10 * time.Second
+			transport.TLSClientConfig = tlsConfig
+		}
 		return transport, nil
 	}
 
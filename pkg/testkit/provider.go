@@ -0,0 +1,268 @@
+package testkit
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	sysv1alpha1 "bytetrade.io/web3os/system-server/pkg/apis/sys/v1alpha1"
+	serviceproxy "bytetrade.io/web3os/system-server/pkg/serviceproxy/v1alpha1"
+
+	"github.com/emicklei/go-restful/v3"
+)
+
+// Request is a request received by a FakeProvider.
+type Request struct {
+	Method string
+	Path   string
+	Header http.Header
+	Body   []byte
+}
+
+// ProxyRequest decodes the body as the ProxyRequest of an op.
+func (r *Request) ProxyRequest() (*serviceproxy.ProxyRequest, error) {
+	var req serviceproxy.ProxyRequest
+	if err := json.Unmarshal(r.Body, &req); err != nil {
+		return nil, err
+	}
+
+	return &req, nil
+}
+
+// DispatchRequest decodes the body as the DispatchRequest of a watcher callback,
+// in any of the formats of callbacks.
+func (r *Request) DispatchRequest() (*serviceproxy.DispatchRequest, error) {
+	var event *serviceproxy.CloudEvent
+	body := r.Body
+	if strings.HasPrefix(r.Header.Get(restful.HEADER_ContentType), serviceproxy.CloudEventsContentType) {
+		event = &serviceproxy.CloudEvent{}
+		if err := json.Unmarshal(body, event); err != nil {
+			return nil, err
+		}
+		body = event.Data
+	}
+
+	// the data of CloudEvents has the same fields as the legacy format
+	var req serviceproxy.DispatchRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, err
+	}
+
+	if event != nil {
+		req.ID, req.Time, req.Cursor = event.ID, event.Time, event.Cursor
+	}
+
+	return &req, nil
+}
+
+// Response is the response of a FakeProvider.
+type Response struct {
+	// Status is http.StatusOK if it's 0.
+	Status int
+	Header http.Header
+	// Body is encoded in json, except []byte and string are written as is.
+	Body interface{}
+}
+
+// HandlerFunc returns the response of a request to a FakeProvider, nil for the
+// default response {}.
+type HandlerFunc func(req *Request) *Response
+
+// FakeProvider is a provider or watcher serving in process, it records all the
+// requests and responds as programmed, {} by default.
+type FakeProvider struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	handlers map[string]HandlerFunc
+	requests []*Request
+	// closed and renewed on every request
+	received chan struct{}
+}
+
+// NewFakeProvider starts a FakeProvider, it should be closed after use.
+func NewFakeProvider() *FakeProvider {
+	p := &FakeProvider{
+		handlers: make(map[string]HandlerFunc),
+		received: make(chan struct{}),
+	}
+	p.Server = httptest.NewServer(http.HandlerFunc(p.serveHTTP))
+
+	return p
+}
+
+// Endpoint returns the endpoint of the provider for the ProviderRegistry.
+func (p *FakeProvider) Endpoint() string {
+	return strings.TrimPrefix(p.URL, "http://")
+}
+
+// Handle programs the responses of requests to path.
+func (p *FakeProvider) Handle(path string, h HandlerFunc) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.handlers[path] = h
+}
+
+// Respond programs the response of requests to path, body is encoded in json.
+func (p *FakeProvider) Respond(path string, body interface{}) {
+	p.Handle(path, func(*Request) *Response {
+		return &Response{Body: body}
+	})
+}
+
+// Requests returns all the recorded requests in order.
+func (p *FakeProvider) Requests() []*Request {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]*Request(nil), p.requests...)
+}
+
+// RequestsTo returns the recorded requests to path in order.
+func (p *FakeProvider) RequestsTo(path string) []*Request {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var requests []*Request
+	for _, r := range p.requests {
+		if r.Path == path {
+			requests = append(requests, r)
+		}
+	}
+
+	return requests
+}
+
+// WaitForRequests waits until n requests to path are recorded, e.g. the callbacks
+// delivered to a watcher asynchronously.
+func (p *FakeProvider) WaitForRequests(ctx context.Context, path string, n int) ([]*Request, error) {
+	for {
+		p.mu.Lock()
+		received := p.received
+		p.mu.Unlock()
+
+		if requests := p.RequestsTo(path); len(requests) >= n {
+			return requests, nil
+		}
+
+		select {
+		case <-received:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Reset forgets the recorded requests, the programmed responses are kept.
+func (p *FakeProvider) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.requests = nil
+}
+
+// Provider returns the ProviderRegistry of a provider serving the ops at /<op>
+// of the FakeProvider, e.g. /Get.
+func (p *FakeProvider) Provider(name, dataType, group, version string, ops ...string) *sysv1alpha1.ProviderRegistry {
+	pr := p.registry(name, sysv1alpha1.Provider, dataType, group, version)
+	for _, op := range ops {
+		pr.Spec.OpApis = append(pr.Spec.OpApis, sysv1alpha1.OpApisItem{Name: op, URI: "/" + op})
+	}
+
+	return pr
+}
+
+// Watcher returns the ProviderRegistry of a watcher receiving the callbacks of
+// ops at /callbacks/<op> of the FakeProvider, e.g. /callbacks/Create.
+func (p *FakeProvider) Watcher(name, dataType, group, version string, ops ...string) *sysv1alpha1.ProviderRegistry {
+	pr := p.registry(name, sysv1alpha1.Watcher, dataType, group, version)
+	for _, op := range ops {
+		pr.Spec.Callbacks = append(pr.Spec.Callbacks, sysv1alpha1.Callback{Op: op, URI: CallbackPath(op)})
+	}
+
+	return pr
+}
+
+// CallbackPath returns the path of the callbacks of op to the watchers from
+// FakeProvider.Watcher.
+func CallbackPath(op string) string {
+	return "/callbacks/" + op
+}
+
+func (p *FakeProvider) registry(name, kind, dataType, group, version string) *sysv1alpha1.ProviderRegistry {
+	pr := &sysv1alpha1.ProviderRegistry{}
+	pr.Name = name
+	pr.Spec = sysv1alpha1.ProviderRegistrySpec{
+		Kind:     kind,
+		DataType: dataType,
+		Group:    group,
+		Version:  version,
+		Endpoint: p.Endpoint(),
+	}
+	pr.Status.State = sysv1alpha1.Active
+
+	return pr
+}
+
+func (p *FakeProvider) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	req := &Request{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Header: r.Header.Clone(),
+		Body:   body,
+	}
+
+	p.mu.Lock()
+	p.requests = append(p.requests, req)
+	close(p.received)
+	p.received = make(chan struct{})
+	handler := p.handlers[req.Path]
+	p.mu.Unlock()
+
+	var resp *Response
+	if handler != nil {
+		resp = handler(req)
+	}
+	if resp == nil {
+		resp = &Response{Body: map[string]interface{}{}}
+	}
+
+	for k, v := range resp.Header {
+		w.Header()[k] = v
+	}
+
+	var data []byte
+	switch b := resp.Body.(type) {
+	case []byte:
+		data = b
+	case string:
+		data = []byte(b)
+	default:
+		if data, err = json.Marshal(b); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if w.Header().Get(restful.HEADER_ContentType) == "" {
+			w.Header().Set(restful.HEADER_ContentType, restful.MIME_JSON)
+		}
+	}
+
+	status := resp.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	w.WriteHeader(status)
+	_, _ = w.Write(data)
+}
@@ -0,0 +1,320 @@
+// Package testkit runs system-server and providers in process, to test the
+// providers and watchers without a cluster.
+package testkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	sysv1alpha1 "bytetrade.io/web3os/system-server/pkg/apis/sys/v1alpha1"
+	apiserver "bytetrade.io/web3os/system-server/pkg/apiserver/v1alpha1"
+	"bytetrade.io/web3os/system-server/pkg/apiserver/v1alpha1/api"
+	"bytetrade.io/web3os/system-server/pkg/apiserver/v1alpha1/api/response"
+	"bytetrade.io/web3os/system-server/pkg/constants"
+	sysfake "bytetrade.io/web3os/system-server/pkg/generated/clientset/versioned/fake"
+	informers "bytetrade.io/web3os/system-server/pkg/generated/informers/externalversions"
+	listers "bytetrade.io/web3os/system-server/pkg/generated/listers/sys/v1alpha1"
+	permission "bytetrade.io/web3os/system-server/pkg/permission/v1alpha1"
+	prodiverregistry "bytetrade.io/web3os/system-server/pkg/providerregistry/v1alpha1"
+
+	"github.com/emicklei/go-restful/v3"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	// DataAPIPath is the root path of the data api.
+	DataAPIPath = "/system-server/v1alpha1"
+
+	// Namespace is the namespace of system-server if MY_NAMESPACE is not set.
+	Namespace = "user-system-testkit"
+)
+
+// Server is an in-process system-server serving the data api, backed by the fake
+// clientsets. The providers, watchers and apps are registered in its Namespace.
+type Server struct {
+	*httptest.Server
+
+	// Namespace is the namespace of system-server, constants.MyNamespace or the
+	// default Namespace if it's not set.
+	Namespace string
+
+	// SysClient holds the ProviderRegistries and ApplicationPermissions.
+	SysClient *sysfake.Clientset
+
+	// KubeClient holds the schema ConfigMaps of providers.
+	KubeClient *kubefake.Clientset
+
+	providerLister   listers.ProviderRegistryLister
+	permissionLister listers.ApplicationPermissionLister
+	ctrlSet          *permission.PermissionControlSet
+
+	cancel context.CancelFunc
+	dir    string
+}
+
+// NewServer starts a Server with the objects of sys.bytetrade.io, it should be
+// closed after use.
+func NewServer(objects ...runtime.Object) (*Server, error) {
+	dir, err := os.MkdirTemp("", "system-server-testkit")
+	if err != nil {
+		return nil, err
+	}
+
+	namespace := constants.MyNamespace
+	if namespace == "" {
+		namespace = Namespace
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Server{
+		Namespace:  namespace,
+		SysClient:  sysfake.NewSimpleClientset(objects...),
+		KubeClient: kubefake.NewSimpleClientset(),
+		cancel:     cancel,
+		dir:        dir,
+	}
+
+	informerFactory := informers.NewSharedInformerFactory(s.SysClient, 0)
+	providerInformer := informerFactory.Sys().V1alpha1().ProviderRegistries()
+	permissionInformer := informerFactory.Sys().V1alpha1().ApplicationPermissions()
+	providerInformer.Informer()
+	permissionInformer.Informer()
+
+	informerFactory.Start(ctx.Done())
+	informerFactory.WaitForCacheSync(ctx.Done())
+	s.providerLister = providerInformer.Lister()
+	s.permissionLister = permissionInformer.Lister()
+
+	registry := prodiverregistry.NewRegistryInNamespace(s.SysClient, s.providerLister, namespace)
+	s.ctrlSet = &permission.PermissionControlSet{
+		Ctrl: permission.NewPermissionControlInNamespace(s.SysClient, s.permissionLister, namespace),
+		Mgr:  permission.NewAccessManager(),
+	}
+
+	container := restful.NewContainer()
+	container.Router(restful.CurlyRouter{})
+
+	// there's no RBAC of v2alpha1 in tests, the dead letters are served to the
+	// owner, as Do calls
+	allowOwner := func(f restful.RouteFunction) restful.RouteFunction { return f }
+	err = apiserver.AddDataAPIToContainer(ctx, container, &rest.Config{}, registry, s.ctrlSet, allowOwner,
+		apiserver.DataAPIOptions{
+			KubeClient:     s.KubeClient,
+			DBPath:         filepath.Join(dir, "system-server.db"),
+			SigningKeyPath: filepath.Join(dir, "signing.key"),
+			Namespace:      namespace,
+		})
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	s.Server = httptest.NewServer(container)
+	return s, nil
+}
+
+// Close shuts down the server and removes its data.
+func (s *Server) Close() {
+	if s.Server != nil {
+		s.Server.Close()
+	}
+	s.cancel()
+	os.RemoveAll(s.dir)
+}
+
+// RegisterProvider registers the provider or watcher, it returns once the
+// registry sees it.
+func (s *Server) RegisterProvider(ctx context.Context, pr *sysv1alpha1.ProviderRegistry) error {
+	pr = pr.DeepCopy()
+	pr.Namespace = s.Namespace
+	if pr.Status.State == "" {
+		pr.Status.State = sysv1alpha1.Active
+	}
+
+	_, err := s.SysClient.SysV1alpha1().ProviderRegistries(pr.Namespace).Create(ctx, pr, metav1.CreateOptions{})
+	if err != nil {
+		return err
+	}
+
+	return s.waitForProvider(ctx, pr.Name, true)
+}
+
+// UnregisterProvider deletes the provider or watcher, it returns once the
+// registry forgets it.
+func (s *Server) UnregisterProvider(ctx context.Context, name string) error {
+	err := s.SysClient.SysV1alpha1().ProviderRegistries(s.Namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil {
+		return err
+	}
+
+	return s.waitForProvider(ctx, name, false)
+}
+
+func (s *Server) waitForProvider(ctx context.Context, name string, exists bool) error {
+	return wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 10*time.Second, true,
+		func(context.Context) (bool, error) {
+			_, err := s.providerLister.ProviderRegistries(s.Namespace).Get(name)
+			if apierrors.IsNotFound(err) {
+				return !exists, nil
+			}
+
+			return exists && err == nil, err
+		})
+}
+
+// Owner returns the user owning the Namespace.
+func (s *Server) Owner() string {
+	return strings.TrimPrefix(s.Namespace, "user-system-")
+}
+
+// RegisterApp creates the ApplicationPermission of app granted perms, as the app
+// installer does, it returns the key and secret of the app once the permission
+// control sees it.
+func (s *Server) RegisterApp(ctx context.Context, app string, perms ...sysv1alpha1.PermissionRequire) (appKey, appSecret string, err error) {
+	ap := &sysv1alpha1.ApplicationPermission{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      app,
+			Namespace: s.Namespace,
+		},
+		Spec: sysv1alpha1.ApplicationPermissionSpec{
+			App:        app,
+			Appid:      app,
+			Key:        "bytetrade_" + app + "_" + uuid.New().String()[:8],
+			Secret:     uuid.New().String()[:16],
+			Permission: perms,
+		},
+		Status: sysv1alpha1.ApplicationPermissionStatus{
+			State: sysv1alpha1.Active,
+		},
+	}
+
+	_, err = s.SysClient.SysV1alpha1().ApplicationPermissions(s.Namespace).Create(ctx, ap, metav1.CreateOptions{})
+	if err != nil {
+		return "", "", err
+	}
+
+	err = wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 10*time.Second, true,
+		func(context.Context) (bool, error) {
+			_, err := s.permissionLister.ApplicationPermissions(s.Namespace).Get(app)
+			if apierrors.IsNotFound(err) {
+				return false, nil
+			}
+
+			return err == nil, err
+		})
+	if err != nil {
+		return "", "", err
+	}
+
+	return ap.Spec.Key, ap.Spec.Secret, nil
+}
+
+// AccessToken requests an access token of perm with the key and secret of the
+// app, as the app does.
+func (s *Server) AccessToken(ctx context.Context, appKey, appSecret string, perm sysv1alpha1.PermissionRequire) (string, error) {
+	timestamp := time.Now().Unix()
+	hash, err := bcrypt.GenerateFromPassword([]byte(appKey+strconv.FormatInt(timestamp, 10)+appSecret), bcrypt.MinCost)
+	if err != nil {
+		return "", err
+	}
+
+	token, err := permission.IssueAccessToken(ctx, &permission.AccessTokenRequest{
+		AppKey:    appKey,
+		Timestamp: timestamp,
+		Token:     string(hash),
+		Perm:      perm,
+	}, s.ctrlSet)
+	if err != nil {
+		return "", err
+	}
+
+	return token.AccessToken, nil
+}
+
+// GrantAccessToken registers app granted perm, and returns an access token of it.
+func (s *Server) GrantAccessToken(ctx context.Context, app string, perm sysv1alpha1.PermissionRequire) (string, error) {
+	appKey, appSecret, err := s.RegisterApp(ctx, app, perm)
+	if err != nil {
+		return "", err
+	}
+
+	return s.AccessToken(ctx, appKey, appSecret, perm)
+}
+
+// DataPath returns the path of the data api, e.g. DataPath("calendar", "g", "v1", "id")
+// for the calendar data with id.
+func DataPath(dataType, group, version string, elems ...string) string {
+	return path.Join(append([]string{DataAPIPath, dataType, group, version}, elems...)...)
+}
+
+// Do calls the data api with the access token as the Owner behind the ingress,
+// body is encoded in json if it's not nil. The errors of the data api are in the
+// code of response, it's the http status if the error is problem details.
+func (s *Server) Do(ctx context.Context, method, path, token string, body interface{}) (*response.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, s.URL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(restful.HEADER_ContentType, restful.MIME_JSON)
+	req.Header.Set(constants.BflUserKey, s.Owner())
+	if token != "" {
+		req.Header.Set(api.AccessTokenHeader, token)
+	}
+
+	resp, err := s.Client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.HasPrefix(resp.Header.Get(restful.HEADER_ContentType), api.MIME_PROBLEM_JSON) {
+		var problem api.Problem
+		if err := json.Unmarshal(data, &problem); err != nil {
+			return nil, fmt.Errorf("invalid problem details, status %d, %s", resp.StatusCode, string(data))
+		}
+
+		return &response.Response{
+			Header: response.Header{Code: problem.Status, Message: problem.Detail, Reason: string(problem.Reason)},
+			Data:   problem.Details,
+		}, nil
+	}
+
+	var ret response.Response
+	if err := json.Unmarshal(data, &ret); err != nil {
+		return nil, fmt.Errorf("invalid response, status %d, %s", resp.StatusCode, string(data))
+	}
+
+	return &ret, nil
+}
@@ -0,0 +1,258 @@
+package testkit
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	sysv1alpha1 "bytetrade.io/web3os/system-server/pkg/apis/sys/v1alpha1"
+	"bytetrade.io/web3os/system-server/pkg/apiserver/v1alpha1/api"
+)
+
+func newServer(t *testing.T) (*Server, context.Context) {
+	t.Helper()
+
+	s, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	t.Cleanup(cancel)
+
+	return s, ctx
+}
+
+func newFakeProvider(t *testing.T) *FakeProvider {
+	t.Helper()
+
+	p := NewFakeProvider()
+	t.Cleanup(p.Close)
+
+	return p
+}
+
+func perm(ops ...string) sysv1alpha1.PermissionRequire {
+	return sysv1alpha1.PermissionRequire{DataType: "calendar", Group: "g", Version: "v1", Ops: ops}
+}
+
+func TestProviderRoundTrip(t *testing.T) {
+	s, ctx := newServer(t)
+	p := newFakeProvider(t)
+	p.Respond("/Get", map[string]interface{}{"id": "1", "title": "standup"})
+
+	if err := s.RegisterProvider(ctx, p.Provider("calendar", "calendar", "g", "v1", sysv1alpha1.Get)); err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := s.GrantAccessToken(ctx, "calendar-app", perm(sysv1alpha1.Get))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := s.Do(ctx, http.MethodGet, DataPath("calendar", "g", "v1", "1"), token, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Code != 0 {
+		t.Fatalf("get data, code %d, %s", resp.Code, resp.Message)
+	}
+
+	data, _ := resp.Data.(map[string]interface{})
+	if data["title"] != "standup" {
+		t.Errorf("got data %v", resp.Data)
+	}
+
+	requests := p.RequestsTo("/Get")
+	if len(requests) != 1 {
+		t.Fatalf("got %d requests to the provider", len(requests))
+	}
+
+	req, err := requests[0].ProxyRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Op != sysv1alpha1.Get || req.DataType != "calendar" || req.AppKey == "" {
+		t.Errorf("got proxy request %+v", req)
+	}
+}
+
+func TestProviderDeniesOpNotGranted(t *testing.T) {
+	s, ctx := newServer(t)
+	p := newFakeProvider(t)
+
+	provider := p.Provider("calendar", "calendar", "g", "v1", sysv1alpha1.Get, sysv1alpha1.Delete)
+	if err := s.RegisterProvider(ctx, provider); err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := s.GrantAccessToken(ctx, "calendar-app", perm(sysv1alpha1.Get))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := s.Do(ctx, http.MethodDelete, DataPath("calendar", "g", "v1", "1"), token, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Reason != string(api.ReasonForbidden) {
+		t.Errorf("delete not granted, got code %d, reason %q", resp.Code, resp.Reason)
+	}
+	if n := len(p.Requests()); n != 0 {
+		t.Errorf("got %d requests to the provider", n)
+	}
+}
+
+func TestAccessTokenOfPermissionNotGranted(t *testing.T) {
+	s, ctx := newServer(t)
+
+	appKey, appSecret, err := s.RegisterApp(ctx, "calendar-app", perm(sysv1alpha1.Get))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = s.AccessToken(ctx, appKey, appSecret, perm(sysv1alpha1.Delete)); err == nil {
+		t.Error("access token issued for an op not granted")
+	}
+
+	if _, err = s.AccessToken(ctx, appKey, "wrong secret", perm(sysv1alpha1.Get)); err == nil {
+		t.Error("access token issued with a wrong secret")
+	}
+}
+
+func TestWatcherCallback(t *testing.T) {
+	s, ctx := newServer(t)
+	provider := newFakeProvider(t)
+	watcher := newFakeProvider(t)
+	provider.Respond("/Create", map[string]interface{}{"id": "1"})
+
+	if err := s.RegisterProvider(ctx, provider.Provider("calendar", "calendar", "g", "v1", sysv1alpha1.Create)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RegisterProvider(ctx, watcher.Watcher("calendar-watcher", "calendar", "g", "v1", sysv1alpha1.Create)); err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := s.GrantAccessToken(ctx, "calendar-app", perm(sysv1alpha1.Create))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := s.Do(ctx, http.MethodPost, DataPath("calendar", "g", "v1"), token,
+		map[string]interface{}{"title": "standup"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Code != 0 {
+		t.Fatalf("create data, code %d, %s", resp.Code, resp.Message)
+	}
+
+	requests, err := watcher.WaitForRequests(ctx, CallbackPath(sysv1alpha1.Create), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := requests[0].DispatchRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Op != sysv1alpha1.Create || req.DataType != "calendar" {
+		t.Errorf("got callback %+v", req)
+	}
+	if req.Token != "" {
+		t.Error("access token of the caller delivered to the watcher")
+	}
+
+	result, _ := req.Result.(map[string]interface{})
+	if result["id"] != "1" {
+		t.Errorf("got result %v", req.Result)
+	}
+}
+
+func TestDeadLettersServedToOwner(t *testing.T) {
+	s, ctx := newServer(t)
+
+	resp, err := s.Do(ctx, http.MethodGet, DataAPIPath+"/deadletters", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Code != 0 {
+		t.Errorf("list dead letters, code %d, %s", resp.Code, resp.Message)
+	}
+}
+
+func TestHandlerFuncNilResponds(t *testing.T) {
+	s, ctx := newServer(t)
+	p := newFakeProvider(t)
+	p.Handle("/Get", func(*Request) *Response { return nil })
+
+	if err := s.RegisterProvider(ctx, p.Provider("calendar", "calendar", "g", "v1", sysv1alpha1.Get)); err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := s.GrantAccessToken(ctx, "calendar-app", perm(sysv1alpha1.Get))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := s.Do(ctx, http.MethodGet, DataPath("calendar", "g", "v1", "1"), token, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Code != 0 {
+		t.Errorf("get data, code %d, %s", resp.Code, resp.Message)
+	}
+}
+
+func TestProviderErrors(t *testing.T) {
+	s, ctx := newServer(t)
+	p := newFakeProvider(t)
+
+	if err := s.RegisterProvider(ctx, p.Provider("calendar", "calendar", "g", "v1", sysv1alpha1.Get)); err != nil {
+		t.Fatal(err)
+	}
+
+	calendar, err := s.GrantAccessToken(ctx, "calendar-app", perm(sysv1alpha1.Get))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contactPerm := perm(sysv1alpha1.Get)
+	contactPerm.DataType = "contact"
+	contact, err := s.GrantAccessToken(ctx, "contact-app", contactPerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name   string
+		status int
+		path   string
+		token  string
+		want   api.Reason
+	}{
+		{"not found", http.StatusNotFound, DataPath("calendar", "g", "v1", "1"), calendar, api.ReasonNotFound},
+		{"conflict", http.StatusConflict, DataPath("calendar", "g", "v1", "1"), calendar, api.ReasonConflict},
+		{"unauthorized", http.StatusUnauthorized, DataPath("calendar", "g", "v1", "1"), calendar, api.ReasonProviderUnavailable},
+		{"bad request", http.StatusBadRequest, DataPath("calendar", "g", "v1", "1"), calendar, api.ReasonProviderUnavailable},
+		{"no provider", http.StatusOK, DataPath("contact", "g", "v1", "1"), contact, api.ReasonNotFound},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p.Handle("/Get", func(*Request) *Response {
+				return &Response{Status: c.status}
+			})
+
+			resp, err := s.Do(ctx, http.MethodGet, c.path, c.token, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Reason != string(c.want) {
+				t.Errorf("got code %d, reason %q, want %q", resp.Code, resp.Reason, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+// Package tracing traces the requests through system-server with OpenTelemetry,
+// from the api server to the providers and the watcher deliveries.
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"bytetrade.io/web3os/system-server/pkg/constants"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/klog/v2"
+)
+
+const (
+	instrumentationName = "bytetrade.io/web3os/system-server"
+
+	// TraceParentHeader is the W3C trace context header.
+	TraceParentHeader = "traceparent"
+)
+
+// Init exports the spans to the OTLP collector of constants.TracingEndpoint, and
+// propagates the trace context in the W3C headers. The spans are dropped until
+// it's called. The returned func flushes the spans on shutdown.
+func Init(ctx context.Context) (func(context.Context) error, error) {
+	exporter, err := otlptracegrpc.New(ctx, endpointOptions(constants.TracingEndpoint)...)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(constants.ProxyServerServiceName),
+		semconv.ServiceNamespace(constants.MyNamespace),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(constants.TracingSampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	klog.Info("exporting traces to ", constants.TracingEndpoint, ", sample ratio: ", constants.TracingSampleRatio)
+	return provider.Shutdown, nil
+}
+
+// endpointOptions returns the options of the collector endpoint, host:port is a
+// local collector in plaintext.
+func endpointOptions(endpoint string) []otlptracegrpc.Option {
+	if strings.Contains(endpoint, "://") {
+		return []otlptracegrpc.Option{otlptracegrpc.WithEndpointURL(endpoint)}
+	}
+
+	return []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(endpoint), otlptracegrpc.WithInsecure()}
+}
+
+// Start starts a span as the child of the span in ctx.
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, opts...)
+}
+
+// End ends the span, with the error status if err is not nil.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+// Inject writes the trace context of ctx to the headers of an outgoing request.
+func Inject(ctx context.Context, header http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// Extract returns ctx with the trace context of the caller in the headers of an
+// incoming request.
+func Extract(ctx context.Context, header http.Header) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(header))
+}
+
+// TraceParent returns the traceparent of the span in ctx, to be persisted with
+// the work done later, e.g. the watcher deliveries. Empty if there is no span.
+func TraceParent(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+
+	return carrier.Get(TraceParentHeader)
+}
+
+// WithTraceParent returns ctx with the remote span of traceparent, as the parent
+// of the spans of the work done later.
+func WithTraceParent(ctx context.Context, traceparent string) context.Context {
+	if traceparent == "" {
+		return ctx
+	}
+
+	carrier := propagation.MapCarrier{TraceParentHeader: traceparent}
+	return propagation.TraceContext{}.Extract(ctx, carrier)
+}
@@ -3,6 +3,7 @@ package apitools
 import (
 	"fmt"
 	"net/http"
+	"strings"
 
 	"bytetrade.io/web3os/system-server/pkg/apiserver/v1alpha1/api"
 	"bytetrade.io/web3os/system-server/pkg/constants"
@@ -12,6 +13,9 @@ import (
 )
 
 type BaseHandler struct {
+	// Namespace is the namespace of system-server, the users of it and its
+	// userspace are valid, constants.MyNamespace if empty.
+	Namespace string
 }
 
 func (h *BaseHandler) GetUser(req *restful.Request) (string, error) {
@@ -50,8 +54,14 @@ func (h *BaseHandler) Validate(req *restful.Request, resp *restful.Response) (ok
 		namespace = "user-system-" + username
 	}
 
+	myNamespace := h.Namespace
+	if myNamespace == "" {
+		myNamespace = constants.MyNamespace
+	}
+	myUserspace := strings.Replace(myNamespace, "user-system-", "user-space-", 1)
+
 	klog.Infof("User %s is a system user in namespace %s", username, namespace)
-	if constants.MyNamespace != namespace && constants.MyUserspace != namespace {
+	if myNamespace != namespace && myUserspace != namespace {
 		api.HandleUnauthorized(resp, req, fmt.Errorf("invalid user, %s", username))
 		return
 	}
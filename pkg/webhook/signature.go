@@ -0,0 +1,220 @@
+package webhook
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// HeaderDeliveryID is the id of the delivery, it keeps the same across retries.
+	HeaderDeliveryID = "X-Terminus-Delivery"
+	// HeaderTimestamp is the unix time in seconds when the delivery was signed.
+	HeaderTimestamp = "X-Terminus-Timestamp"
+	// HeaderSignature is the signature of the delivery, "v1=<hex hmac-sha256>" if the
+	// watcher has a secret, or "ed25519=<base64 signature>" signed with the server key.
+	HeaderSignature = "X-Terminus-Signature"
+
+	SchemeHMAC    = "v1"
+	SchemeEd25519 = "ed25519"
+
+	// DefaultTolerance is the max age of a signed delivery accepted by the verify helpers.
+	DefaultTolerance = 5 * time.Minute
+)
+
+var (
+	ErrMissingHeaders   = errors.New("webhook: missing signature headers")
+	ErrInvalidSignature = errors.New("webhook: invalid signature")
+	ErrExpired          = errors.New("webhook: timestamp out of tolerance")
+)
+
+// signedContent returns the content to be signed, "<delivery id>.<timestamp>.<body>".
+func signedContent(id, timestamp string, body []byte) []byte {
+	content := make([]byte, 0, len(id)+len(timestamp)+len(body)+2)
+	content = append(content, id...)
+	content = append(content, '.')
+	content = append(content, timestamp...)
+	content = append(content, '.')
+	return append(content, body...)
+}
+
+// SignHMAC returns the HMAC-SHA256 signature header value of a delivery.
+func SignHMAC(secret, id, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(signedContent(id, timestamp, body))
+	return SchemeHMAC + "=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignEd25519 returns the ed25519 signature header value of a delivery.
+func SignEd25519(key ed25519.PrivateKey, id, timestamp string, body []byte) string {
+	sig := ed25519.Sign(key, signedContent(id, timestamp, body))
+	return SchemeEd25519 + "=" + base64.StdEncoding.EncodeToString(sig)
+}
+
+// Sign sets the delivery id, timestamp and signature headers of a delivery. The
+// secret of watcher is preferred, the key of server is used if the secret is empty.
+func Sign(header http.Header, secret string, key ed25519.PrivateKey, id string, body []byte) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	header.Set(HeaderDeliveryID, id)
+	header.Set(HeaderTimestamp, timestamp)
+
+	switch {
+	case secret != "":
+		header.Set(HeaderSignature, SignHMAC(secret, id, timestamp, body))
+	case key != nil:
+		header.Set(HeaderSignature, SignEd25519(key, id, timestamp, body))
+	}
+}
+
+// VerifyHMAC verifies a delivery signed with the watcher's secret.
+func VerifyHMAC(header http.Header, body []byte, secret string, tolerance time.Duration) error {
+	id, timestamp, signature, err := parseHeaders(header, SchemeHMAC, tolerance)
+	if err != nil {
+		return err
+	}
+
+	expected := SignHMAC(secret, id, timestamp, body)
+	if !hmac.Equal([]byte(expected[len(SchemeHMAC)+1:]), []byte(signature)) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// VerifyEd25519 verifies a delivery signed with the server key, the public key is
+// published by system-server.
+func VerifyEd25519(header http.Header, body []byte, publicKey ed25519.PublicKey, tolerance time.Duration) error {
+	id, timestamp, signature, err := parseHeaders(header, SchemeEd25519, tolerance)
+	if err != nil {
+		return err
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	if !ed25519.Verify(publicKey, signedContent(id, timestamp, body), sig) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+func parseHeaders(header http.Header, scheme string, tolerance time.Duration) (id, timestamp, signature string, err error) {
+	id = header.Get(HeaderDeliveryID)
+	timestamp = header.Get(HeaderTimestamp)
+	signature = header.Get(HeaderSignature)
+	if id == "" || timestamp == "" || signature == "" {
+		return "", "", "", ErrMissingHeaders
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return "", "", "", fmt.Errorf("webhook: invalid timestamp, %s", timestamp)
+	}
+
+	if tolerance > 0 && math.Abs(float64(time.Now().Unix()-ts)) > tolerance.Seconds() {
+		return "", "", "", ErrExpired
+	}
+
+	s, found := strings.CutPrefix(signature, scheme+"=")
+	if !found {
+		return "", "", "", fmt.Errorf("webhook: unexpected signature scheme, want %s", scheme)
+	}
+
+	return id, timestamp, s, nil
+}
+
+// LoadOrGenerateKey loads the ed25519 signing key in PEM from path, a new key is
+// generated and saved if the file does not exist.
+func LoadOrGenerateKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("invalid signing key file, %s", path)
+		}
+
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+
+		edKey, ok := key.(ed25519.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("signing key is not an ed25519 key, %s", path)
+		}
+
+		return edKey, nil
+	}
+
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+
+	if err = os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// EncodePublicKey encodes the public key in PEM, as it's published by system-server.
+func EncodePublicKey(key ed25519.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), nil
+}
+
+// ParsePublicKey parses the PEM public key published by system-server.
+func ParsePublicKey(data string) (ed25519.PublicKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, errors.New("webhook: invalid public key")
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	edKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, errors.New("webhook: public key is not an ed25519 key")
+	}
+
+	return edKey, nil
+}
@@ -0,0 +1,151 @@
+package webhook
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newKey(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+func TestVerifyHMAC(t *testing.T) {
+	body := []byte(`{"op":"Create"}`)
+	signed := func() http.Header {
+		header := http.Header{}
+		Sign(header, "s3cret", nil, "42", body)
+		return header
+	}
+
+	if err := VerifyHMAC(signed(), body, "s3cret", DefaultTolerance); err != nil {
+		t.Fatalf("verify signed delivery, %v", err)
+	}
+
+	cases := []struct {
+		name   string
+		header func() http.Header
+		body   []byte
+		secret string
+		want   error
+	}{
+		{"wrong secret", signed, body, "other", ErrInvalidSignature},
+		{"tampered body", signed, []byte(`{"op":"Delete"}`), "s3cret", ErrInvalidSignature},
+		{"tampered id", func() http.Header {
+			header := signed()
+			header.Set(HeaderDeliveryID, "43")
+			return header
+		}, body, "s3cret", ErrInvalidSignature},
+		{"missing signature", func() http.Header {
+			header := signed()
+			header.Del(HeaderSignature)
+			return header
+		}, body, "s3cret", ErrMissingHeaders},
+		{"expired", func() http.Header {
+			header := http.Header{}
+			timestamp := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+			header.Set(HeaderDeliveryID, "42")
+			header.Set(HeaderTimestamp, timestamp)
+			header.Set(HeaderSignature, SignHMAC("s3cret", "42", timestamp, body))
+			return header
+		}, body, "s3cret", ErrExpired},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if err := VerifyHMAC(c.header(), c.body, c.secret, DefaultTolerance); !errors.Is(err, c.want) {
+				t.Errorf("got %v, want %v", err, c.want)
+			}
+		})
+	}
+}
+
+func TestVerifyHMACSchemeMismatch(t *testing.T) {
+	body := []byte("{}")
+	header := http.Header{}
+	Sign(header, "", newKey(t), "1", body)
+
+	if err := VerifyHMAC(header, body, "s3cret", DefaultTolerance); err == nil {
+		t.Fatal("ed25519 signature verified as HMAC")
+	}
+}
+
+func TestVerifyEd25519(t *testing.T) {
+	key := newKey(t)
+	body := []byte(`{"op":"Update"}`)
+
+	header := http.Header{}
+	Sign(header, "", key, "7", body)
+
+	publicKey := key.Public().(ed25519.PublicKey)
+	if err := VerifyEd25519(header, body, publicKey, DefaultTolerance); err != nil {
+		t.Fatalf("verify signed delivery, %v", err)
+	}
+
+	if err := VerifyEd25519(header, []byte("{}"), publicKey, DefaultTolerance); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("tampered body, got %v", err)
+	}
+
+	other := newKey(t).Public().(ed25519.PublicKey)
+	if err := VerifyEd25519(header, body, other, DefaultTolerance); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("other key, got %v", err)
+	}
+}
+
+func TestSignPrefersSecret(t *testing.T) {
+	body := []byte("{}")
+	header := http.Header{}
+	Sign(header, "s3cret", newKey(t), "1", body)
+
+	if err := VerifyHMAC(header, body, "s3cret", DefaultTolerance); err != nil {
+		t.Fatalf("delivery with a secret not signed with HMAC, %v", err)
+	}
+}
+
+func TestPublishedKeyVerifies(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "signing.key")
+
+	key, err := LoadOrGenerateKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadOrGenerateKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !key.Equal(loaded) {
+		t.Fatal("key not reloaded from file")
+	}
+
+	published, err := EncodePublicKey(key.Public().(ed25519.PublicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publicKey, err := ParsePublicKey(published)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := []byte(`{"op":"Delete"}`)
+	header := http.Header{}
+	Sign(header, "", loaded, "9", body)
+
+	if err = VerifyEd25519(header, body, publicKey, DefaultTolerance); err != nil {
+		t.Fatalf("verify with the published key, %v", err)
+	}
+}